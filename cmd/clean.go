@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+/*
+runClean deletes everything from the database
+*/
+func runClean(args []string) {
+	flags, configPath := newFlagSet("clean", "", "Deletes all nodes and edges from the configured database.")
+	yes := flags.Bool("yes", false, "confirm the deletion")
+	_ = flags.Parse(args)
+	if !*yes {
+		slog.Error("refusing to clean the database without -yes")
+		os.Exit(1)
+	}
+
+	cfg := loadConfig(*configPath)
+	neo := openStorage(cfg)
+	defer neo.Close()
+	if err := neo.Clean(); err != nil {
+		fatal("cleaning the database failed", "error", err)
+	}
+	slog.Info("cleaned the database", "uri", cfg.Storage.URI)
+}
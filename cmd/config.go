@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+)
+
+/*
+runConfig prints the effective configuration with the secrets masked
+*/
+func runConfig(args []string) {
+	flags, configPath := newFlagSet("config", "print", "Prints the effective configuration after applying the file and the environment variables.")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 || flags.Arg(0) != "print" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cfg := loadConfig(*configPath)
+	if err := cfg.Print(os.Stdout); err != nil {
+		fatal("printing the configuration failed", "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/geoip"
+	"github.com/SEG-UNIBE/artio-miner/pkg/miner"
+	"github.com/SEG-UNIBE/artio-miner/pkg/policy"
+	"github.com/SEG-UNIBE/artio-miner/pkg/report"
+	"github.com/SEG-UNIBE/artio-miner/pkg/seeds"
+)
+
+/*
+runCrawl crawls the relay network from the seeds and prints the reports
+*/
+func runCrawl(args []string) {
+	flags, configPath := newFlagSet("crawl", "", "Crawls the relay network from the configured seeds and stores the results in the database.")
+	recursion := flags.Int("recursion", -1, "maximum recursion depth, overrides crawl.maxRecursion")
+	runners := flags.Int("runners", 0, "number of parallel runners, overrides crawl.maxRunners")
+	seedSources := flags.String("seeds", "", "comma separated relays or seed sources (file:<path>, stdin, db:valid, db:all, url:<url>, nip66:<relay>) replacing the configured seeds")
+	keep := flags.Bool("keep", false, "keep the results of earlier crawls instead of cleaning the database")
+	noReports := flags.Bool("no-reports", false, "do not print the reports after the crawl")
+	_ = flags.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	if *recursion >= 0 {
+		cfg.Crawl.MaxRecursion = *recursion
+	}
+	if *runners > 0 {
+		cfg.Crawl.MaxRunners = *runners
+	}
+	setupNetwork(cfg)
+	neo := openStorage(cfg)
+	defer neo.Close()
+
+	// the seeds are loaded before cleaning, so that the relays of the last crawl can seed this one
+	if *seedSources != "" {
+		cfg.Seeds = strings.Split(*seedSources, ",")
+	}
+	loader := seeds.Loader{Neo: neo, Stdin: os.Stdin, Nip66Limit: cfg.Crawl.Nip66Limit}
+	relays, err := loader.Load(cfg.Seeds)
+	if err != nil {
+		fatal("loading the seeds failed", "error", err)
+	}
+	if len(relays) == 0 {
+		fatal("no seed relays found")
+	}
+	slog.Info("loaded the seed relays", "relays", len(relays))
+
+	if !*keep {
+		_ = neo.Clean()
+	}
+
+	var geoDatabases *geoip.Databases
+	if cfg.Network.GeoIPCity != "" || cfg.Network.GeoIPASN != "" {
+		geoDatabases, err = geoip.Open(cfg.Network.GeoIPCity, cfg.Network.GeoIPASN)
+		if err != nil {
+			fatal("opening the GeoIP databases failed", "error", err)
+		}
+		defer geoDatabases.Close()
+	}
+
+	// the configuration is validated, so the rules parse
+	crawlPolicy, _ := policy.New(cfg.Policy.Allow, cfg.Policy.Deny)
+
+	manager := miner.Manager{
+		Neo: neo, MaxRecursion: cfg.Crawl.MaxRecursion, MaxRunners: cfg.Crawl.MaxRunners, RateLimit: cfg.Crawl.RateLimit,
+		PushUsers: cfg.Probes.PushUsers, AuthKey: cfg.Probes.AuthPrivateKey, ProbeNips: cfg.Probes.VerifyNips, Census: cfg.Probes.KindCensus,
+		EnrichUsers: cfg.Probes.EnrichUsers, MaxEnrichedUsers: cfg.Probes.MaxEnrichedUsers, EnrichOperators: cfg.Probes.EnrichOperators,
+		Publisher: newPublisher(cfg), GeoIP: geoDatabases, Policy: crawlPolicy, Nip66Sources: cfg.Crawl.Nip66Sources, Nip66Limit: cfg.Crawl.Nip66Limit,
+	}
+	startHTTP(cfg, &manager)
+	manager.Run(relays)
+
+	if !cfg.Output.Reports || *noReports {
+		return
+	}
+
+	softwareVersions, err := report.SoftwareVersions(neo, manager.CrawlId)
+	if err != nil {
+		slog.Error("software version report failed", "error", err)
+		return
+	}
+	report.PrintSoftwareVersions(os.Stdout, softwareVersions)
+
+	compliance, err := report.Nip11Compliance(neo)
+	if err != nil {
+		slog.Error("NIP-11 compliance report failed", "error", err)
+		return
+	}
+	report.PrintNip11Compliance(os.Stdout, compliance)
+
+	operators, err := report.Operators(neo, cfg.Output.OperatorMinRelays)
+	if err != nil {
+		slog.Error("operator report failed", "error", err)
+		return
+	}
+	report.PrintOperators(os.Stdout, operators)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/report"
+)
+
+/*
+runDiff prints the differences between the relays of two crawls
+*/
+func runDiff(args []string) {
+	flags, configPath := newFlagSet("diff", "", "Compares the relays of two crawls stored in the database.")
+	from := flags.String("from", "", "id of the older crawl (default the second latest crawl)")
+	to := flags.String("to", "", "id of the newer crawl (default the latest crawl)")
+	_ = flags.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	neo := openStorage(cfg)
+	defer neo.Close()
+	if *from == "" || *to == "" {
+		crawls, err := report.LatestCrawls(neo, 2)
+		if err != nil || len(crawls) < 2 {
+			fatal("two crawls are needed for a diff, crawl with -keep to retain earlier crawls", "error", err)
+		}
+		if *to == "" {
+			*to = crawls[0]
+		}
+		if *from == "" {
+			*from = crawls[1]
+		}
+	}
+	older, err := report.CrawlRelays(neo, *from)
+	if err != nil {
+		fatal("loading the relays of the crawl failed", "crawl", *from, "error", err)
+	}
+	newer, err := report.CrawlRelays(neo, *to)
+	if err != nil {
+		fatal("loading the relays of the crawl failed", "crawl", *to, "error", err)
+	}
+	report.PrintCrawlDiff(os.Stdout, *from, *to, report.DiffCrawls(older, newer))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/report"
+)
+
+/*
+runExport writes the relays of a crawl as JSON or CSV
+*/
+func runExport(args []string) {
+	flags, configPath := newFlagSet("export", "", "Exports the relays of a crawl with their main results.")
+	crawl := flags.String("crawl", "", "id of the crawl to export (default the latest crawl)")
+	format := flags.String("format", "json", "output format, json or csv")
+	out := flags.String("out", "", "file to write to (default stdout)")
+	_ = flags.Parse(args)
+	cfg := loadConfig(*configPath)
+	if *format != "json" && *format != "csv" {
+		fatal("unknown format, use json or csv", "format", *format)
+	}
+	neo := openStorage(cfg)
+	defer neo.Close()
+	if *crawl == "" {
+		crawls, err := report.LatestCrawls(neo, 1)
+		if err != nil || len(crawls) == 0 {
+			fatal("no crawl found to export", "error", err)
+		}
+		*crawl = crawls[0]
+	}
+	relays, err := report.CrawlRelays(neo, *crawl)
+	if err != nil {
+		fatal("loading the relays of the crawl failed", "crawl", *crawl, "error", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fatal("creating the export file failed", "path", *out, "error", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == "csv" {
+		err = report.WriteCSV(w, relays)
+	} else {
+		err = report.WriteJSON(w, relays)
+	}
+	if err != nil {
+		fatal("writing the export failed", "error", err)
+	}
+}
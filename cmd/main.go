@@ -1,45 +1,176 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
-	"strconv"
+	"time"
 
+	"github.com/SEG-UNIBE/artio-miner/pkg/config"
+	"github.com/SEG-UNIBE/artio-miner/pkg/logging"
+	"github.com/SEG-UNIBE/artio-miner/pkg/metrics"
 	"github.com/SEG-UNIBE/artio-miner/pkg/miner"
+	"github.com/SEG-UNIBE/artio-miner/pkg/status"
 	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
 	"github.com/joho/godotenv"
 )
 
 /*
-main example function for just fetching the data from the relays
+command is a subcommand of the miner
+*/
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands = []command{
+	{name: "crawl", summary: "crawl the relay network from the seeds and store the results", run: runCrawl},
+	{name: "probe", summary: "load a single relay and print its results", run: runProbe},
+	{name: "export", summary: "export the relays of a crawl as JSON or CSV", run: runExport},
+	{name: "diff", summary: "compare the relays of two crawls", run: runDiff},
+	{name: "monitor", summary: "re-probe the known relays periodically and track their uptime", run: runMonitor},
+	{name: "clean", summary: "delete all nodes and edges from the database", run: runClean},
+	{name: "schema", summary: "create the constraints and indexes of the database", run: runSchema},
+	{name: "config", summary: "print the effective configuration", run: runConfig},
+}
+
+/*
+main dispatches to the subcommand, without one a crawl is run
 */
 func main() {
-	startingRelays := []string{"wss://relay.artiostr.ch/", "wss://relay.artio.inf.unibe.ch/"}
-	miners := make([]*miner.RelayMiner, 0)
-	for _, relay := range startingRelays {
-		miners = append(miners, miner.NewMiner(relay))
-	}
-	err := godotenv.Load(".env")
-
-	uri := os.Getenv("NEO4J_URI")
-	password := os.Getenv("NEO4J_PASSWORD")
-	db := os.Getenv("NEO4J_DB")
-	username := os.Getenv("NEO4J_USERNAME")
-	maxRecursion, _ := strconv.ParseInt(os.Getenv("MAX_RECURSION"), 10, 64)
-	maxRunners, _ := strconv.ParseInt(os.Getenv("MAX_RUNNERS"), 10, 64)
-	pushUsers, _ := strconv.ParseBool(os.Getenv("PUSH_USERS"))
-
-	neo := storage.Neo4jInstance{Username: username, Password: password, URI: uri, DBName: db}
-	err = neo.Init()
-	if err != nil {
-		log.Fatalf("Error on neo4j init: %v", err)
+	_ = godotenv.Load(".env")
+	flag.Usage = usage
+	if len(os.Args) < 2 {
+		runCrawl([]string{})
 		return
 	}
-	_ = neo.Clean()
+	name, args := os.Args[1], os.Args[2:]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmd.run(args)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: artio-miner <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'artio-miner <command> -h' for the flags of a command.\n")
+}
+
+/*
+newFlagSet creates the flags of a command with the shared -config flag
+*/
+func newFlagSet(name string, arguments string, description string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := flags.String("config", "", "path of the YAML configuration file (default $ARTIO_CONFIG or ./config.yaml)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: artio-miner %s [flags] %s\n\n%s\n\nFlags:\n", name, arguments, description)
+		flags.PrintDefaults()
+	}
+	return flags, configPath
+}
+
+/*
+loadConfig loads the configuration file, the environment variables override it
+*/
+func loadConfig(path string) *config.Config {
+	if path == "" {
+		path = os.Getenv("ARTIO_CONFIG")
+	}
+	if _, err := os.Stat("config.yaml"); path == "" && err == nil {
+		path = "config.yaml"
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+	setupLogging(cfg)
+	return cfg
+}
+
+/*
+setupLogging installs the configured logger as the default, the log package writes through it as well
+*/
+func setupLogging(cfg *config.Config) {
+	// the configuration is validated, so the logger can be created
+	logger, _ := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level, cfg.Log.Quiet)
+	slog.SetDefault(logger)
+}
+
+/*
+fatal logs the error and exits
+*/
+func fatal(message string, args ...any) {
+	logging.Fatal(slog.Default(), message, args...)
+	os.Exit(1)
+}
+
+/*
+setupNetwork applies the proxy, DNS and timeout settings to the miner
+*/
+func setupNetwork(cfg *config.Config) {
+	if err := miner.SetProxy(cfg.Network.Socks5Proxy); err != nil {
+		fatal("invalid proxy setting", "error", err)
+	}
+	miner.SetDNSServer(cfg.Network.DNSServer)
+	miner.SetTimeouts(time.Duration(cfg.Crawl.Nip11Timeout), time.Duration(cfg.Crawl.RelayListTimeout), time.Duration(cfg.Crawl.ProbeTimeout))
+}
 
-	defer neo.Close()
-	manager := miner.Manager{Neo: &neo, MaxRecursion: int(maxRecursion), MaxRunners: int(maxRunners), PushUsers: pushUsers}
+/*
+openStorage connects to the database of the configuration, the caller closes it
+*/
+func openStorage(cfg *config.Config) *storage.Neo4jInstance {
+	if cfg.Storage.URI == "" {
+		fatal("invalid configuration: storage.uri is required")
+	}
+	neo := &storage.Neo4jInstance{Username: cfg.Storage.Username, Password: cfg.Storage.Password, URI: cfg.Storage.URI, DBName: cfg.Storage.Database}
+	if err := neo.Init(); err != nil {
+		fatal("connecting to neo4j failed", "error", err)
+	}
+	return neo
+}
 
-	manager.Run(startingRelays)
+/*
+newPublisher creates the NIP-66 publisher if a monitor key is configured
+*/
+func newPublisher(cfg *config.Config) *miner.Publisher {
+	if cfg.Monitor.PrivateKey == "" {
+		return nil
+	}
+	return &miner.Publisher{SecretKey: cfg.Monitor.PrivateKey, Relays: cfg.Monitor.Relays, Frequency: time.Duration(cfg.Monitor.Frequency)}
+}
 
+/*
+startHTTP serves the metrics in the background if a listen address is configured
+the status API and dashboard are served as well if a crawl is given
+*/
+func startHTTP(cfg *config.Config, crawl status.Source) {
+	if cfg.HTTP.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	if crawl != nil {
+		mux.Handle("/", status.Handler(crawl))
+	}
+	go func() {
+		slog.Info("serving HTTP", "listen", cfg.HTTP.Listen)
+		if err := http.ListenAndServe(cfg.HTTP.Listen, mux); err != nil {
+			slog.Error("HTTP server failed", "error", err)
+		}
+	}()
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/config"
+	"github.com/SEG-UNIBE/artio-miner/pkg/miner"
+	"github.com/SEG-UNIBE/artio-miner/pkg/policy"
+)
+
+/*
+runMonitor re-probes the relays of earlier crawls until interrupted, the database is kept
+*/
+func runMonitor(args []string) {
+	flags, configPath := newFlagSet("monitor", "", "Re-probes the relays stored by earlier crawls periodically and tracks their uptime until interrupted.")
+	interval := flags.Duration("interval", 0, "time between two checks of a relay, overrides monitor.interval")
+	concurrency := flags.Int("concurrency", 0, "number of relays checked in parallel, overrides monitor.concurrency")
+	_ = flags.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	if *interval > 0 {
+		cfg.Monitor.Interval = config.Duration(*interval)
+	}
+	if *concurrency > 0 {
+		cfg.Monitor.Concurrency = *concurrency
+	}
+	if cfg.Monitor.Concurrency <= 0 {
+		cfg.Monitor.Concurrency = cfg.Crawl.MaxRunners
+	}
+	setupNetwork(cfg)
+	startHTTP(cfg, nil)
+	neo := openStorage(cfg)
+	defer neo.Close()
+
+	publisher := newPublisher(cfg)
+	if publisher != nil {
+		publisher.Frequency = time.Duration(cfg.Monitor.Interval)
+	}
+	// the configuration is validated, so the rules parse
+	monitorPolicy, _ := policy.New(cfg.Policy.Allow, cfg.Policy.Deny)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	monitor := miner.Monitor{Neo: neo, Interval: time.Duration(cfg.Monitor.Interval), Jitter: time.Duration(cfg.Monitor.Jitter), Concurrency: cfg.Monitor.Concurrency, Publisher: publisher, Policy: monitorPolicy}
+	monitor.Run(ctx)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/miner"
+)
+
+/*
+probeOutput is the JSON form of the results of a single relay
+*/
+type probeOutput struct {
+	Relay            string                   `json:"relay"`
+	Valid            bool                     `json:"valid"`
+	InvalidReason    string                   `json:"invalidReason,omitempty"`
+	Ips              []string                 `json:"ips"`
+	Software         string                   `json:"software"`
+	Version          string                   `json:"version"`
+	SupportedNips    []int                    `json:"supportedNips"`
+	Nip11            *miner.Nip11Validation   `json:"nip11,omitempty"`
+	Nip11Timings     map[string]any           `json:"nip11Timings,omitempty"`
+	RelayListTimings map[string]any           `json:"relayListTimings,omitempty"`
+	AuthStatus       string                   `json:"authStatus"`
+	Certificate      *miner.CertificateInfo   `json:"certificate,omitempty"`
+	CertificateError string                   `json:"certificateError,omitempty"`
+	NipVerifications []*miner.NipVerification `json:"nipVerifications,omitempty"`
+	KindCensus       []*miner.KindCount       `json:"kindCensus,omitempty"`
+	Category         string                   `json:"category,omitempty"`
+	Events           int                      `json:"events"`
+	NeighbourRelays  []string                 `json:"neighbourRelays"`
+	Probe            *miner.ProbeResult       `json:"probe"`
+}
+
+/*
+runProbe loads a single relay without storing anything and prints the results
+*/
+func runProbe(args []string) {
+	flags, configPath := newFlagSet("probe", "<relay>", "Loads a single relay and prints its results without touching the database.")
+	asJson := flags.Bool("json", false, "print the results as JSON")
+	recursion := flags.Int("recursion", 0, "also load the relay lists and neighbours if above zero")
+	verifyNips := flags.Bool("verify-nips", false, "actively verify the claimed NIPs")
+	census := flags.Bool("census", false, "estimate the number of events per kind")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg := loadConfig(*configPath)
+	setupNetwork(cfg)
+	relay := miner.NewMiner(flags.Arg(0))
+	relay.RecursionLevel = *recursion
+	relay.AuthKey = cfg.Probes.AuthPrivateKey
+	relay.ProbeNips = *verifyNips || cfg.Probes.VerifyNips
+	relay.Census = *census || cfg.Probes.KindCensus
+	relay.Load()
+
+	if !*asJson {
+		relay.Stats()
+		return
+	}
+	output := probeOutput{
+		Relay: relay.Relay, Valid: relay.IsValid, InvalidReason: relay.InvalidReason, Ips: make([]string, 0),
+		Software: relay.Software(), Version: relay.SoftwareVersion(), SupportedNips: relay.SupportedNips(), Nip11: relay.Nip11Validation,
+		AuthStatus: relay.AuthStatus, Certificate: relay.Certificate, CertificateError: relay.CertificateError,
+		NipVerifications: relay.NipVerifications, KindCensus: relay.KindCensus, Events: len(relay.EventList), NeighbourRelays: relay.GetCleanRelayList(),
+		Probe: relay.Probe,
+	}
+	for _, ip := range relay.Ips {
+		output.Ips = append(output.Ips, ip.String())
+	}
+	if relay.Nip11Timings != nil {
+		output.Nip11Timings = relay.Nip11Timings.Milliseconds()
+	}
+	if relay.RelayListTimings != nil {
+		output.RelayListTimings = relay.RelayListTimings.Milliseconds()
+	}
+	if relay.KindCensus != nil {
+		output.Category = miner.ClassifyRelay(relay.KindCensus)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(output)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
+)
+
+/*
+runSchema creates the constraints and indexes of the graph
+*/
+func runSchema(args []string) {
+	flags, configPath := newFlagSet("schema", "", "Creates the constraints and indexes of the graph that do not exist yet.")
+	printOnly := flags.Bool("print", false, "only print the statements without connecting to the database")
+	_ = flags.Parse(args)
+	if *printOnly {
+		for _, statement := range storage.Schema {
+			fmt.Printf("%s;\n", statement)
+		}
+		return
+	}
+
+	cfg := loadConfig(*configPath)
+	neo := openStorage(cfg)
+	defer neo.Close()
+	if err := neo.ApplySchema(); err != nil {
+		fatal("applying the schema failed", "error", err)
+	}
+	slog.Info("applied the schema", "statements", len(storage.Schema))
+}
@@ -0,0 +1,337 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/logging"
+	"github.com/SEG-UNIBE/artio-miner/pkg/policy"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Config is the complete configuration of the miner, read from a YAML file and overridden by environment variables
+*/
+type Config struct {
+	Seeds   []string `yaml:"seeds" env:"SEEDS"` // relay URLs or seed sources, see seeds.Loader
+	Storage Storage  `yaml:"storage"`
+	Crawl   Crawl    `yaml:"crawl"`
+	Probes  Probes   `yaml:"probes"`
+	Network Network  `yaml:"network"`
+	Policy  Policy   `yaml:"policy"`
+	HTTP    HTTP     `yaml:"http"`
+	Monitor Monitor  `yaml:"monitor"`
+	Output  Output   `yaml:"output"`
+	Log     Log      `yaml:"log"`
+}
+
+/*
+Storage configures the database the results are written to
+*/
+type Storage struct {
+	Backend  string `yaml:"backend" env:"STORAGE_BACKEND"`
+	URI      string `yaml:"uri" env:"NEO4J_URI"`
+	Username string `yaml:"username" env:"NEO4J_USERNAME"`
+	Password string `yaml:"password" env:"NEO4J_PASSWORD" secret:"true"`
+	Database string `yaml:"database" env:"NEO4J_DB"`
+}
+
+/*
+Crawl configures the extent and pace of the crawl
+*/
+type Crawl struct {
+	MaxRecursion     int      `yaml:"maxRecursion" env:"MAX_RECURSION"`
+	MaxRunners       int      `yaml:"maxRunners" env:"MAX_RUNNERS"`
+	RateLimit        float64  `yaml:"rateLimit" env:"RATE_LIMIT"` // relays started per second, zero is unlimited
+	Nip11Timeout     Duration `yaml:"nip11Timeout" env:"NIP11_TIMEOUT"`
+	RelayListTimeout Duration `yaml:"relayListTimeout" env:"RELAY_LIST_TIMEOUT"`
+	ProbeTimeout     Duration `yaml:"probeTimeout" env:"PROBE_TIMEOUT"`
+	Nip66Sources     []string `yaml:"nip66Sources" env:"NIP66_SOURCE_RELAYS"`
+	Nip66Limit       int      `yaml:"nip66Limit" env:"NIP66_LIMIT"`
+}
+
+/*
+Probes enables the optional measurements of a crawl
+*/
+type Probes struct {
+	PushUsers        bool   `yaml:"pushUsers" env:"PUSH_USERS"`
+	AuthPrivateKey   string `yaml:"authPrivateKey" env:"AUTH_PRIVATE_KEY" secret:"true"`
+	VerifyNips       bool   `yaml:"verifyNips" env:"PROBE_NIPS"`
+	KindCensus       bool   `yaml:"kindCensus" env:"KIND_CENSUS"`
+	EnrichUsers      bool   `yaml:"enrichUsers" env:"ENRICH_USERS"`
+	MaxEnrichedUsers int    `yaml:"maxEnrichedUsers" env:"MAX_ENRICHED_USERS"`
+	EnrichOperators  bool   `yaml:"enrichOperators" env:"ENRICH_OPERATORS"`
+}
+
+/*
+Network configures how relays are resolved and reached
+*/
+type Network struct {
+	Socks5Proxy string `yaml:"socks5Proxy" env:"SOCKS5_PROXY"`
+	DNSServer   string `yaml:"dnsServer" env:"DNS_SERVER"`
+	GeoIPCity   string `yaml:"geoipCityDb" env:"GEOIP_CITY_DB"`
+	GeoIPASN    string `yaml:"geoipAsnDb" env:"GEOIP_ASN_DB"`
+}
+
+/*
+Policy restricts the relays that are crawled, see policy.ParseRule for the patterns
+*/
+type Policy struct {
+	Allow []string `yaml:"allow" env:"POLICY_ALLOW"`
+	Deny  []string `yaml:"deny" env:"POLICY_DENY"`
+}
+
+/*
+HTTP configures the embedded server exposing the metrics, the status API and the dashboard
+*/
+type HTTP struct {
+	Listen string `yaml:"listen" env:"HTTP_LISTEN"` // address to listen on, e.g. :9090, empty disables the server
+}
+
+/*
+Monitor configures the NIP-66 publishing and the monitor mode
+*/
+type Monitor struct {
+	PrivateKey  string   `yaml:"privateKey" env:"MONITOR_PRIVATE_KEY" secret:"true"`
+	Relays      []string `yaml:"relays" env:"MONITOR_RELAYS"`
+	Frequency   Duration `yaml:"frequency" env:"MONITOR_FREQUENCY"`
+	Interval    Duration `yaml:"interval" env:"MONITOR_INTERVAL"`
+	Jitter      Duration `yaml:"jitter" env:"MONITOR_JITTER"`
+	Concurrency int      `yaml:"concurrency" env:"MONITOR_CONCURRENCY"`
+}
+
+/*
+Output configures the reports printed after a crawl
+*/
+type Output struct {
+	Reports           bool `yaml:"reports" env:"REPORTS"`
+	OperatorMinRelays int  `yaml:"operatorMinRelays" env:"OPERATOR_MIN_RELAYS"`
+}
+
+/*
+Log configures the structured logging
+*/
+type Log struct {
+	Format string `yaml:"format" env:"LOG_FORMAT"` // text or json
+	Level  string `yaml:"level" env:"LOG_LEVEL"`   // debug, info, warn or error
+	Quiet  bool   `yaml:"quiet" env:"LOG_QUIET"`   // only report the summaries and fatal errors
+}
+
+/*
+Duration is a time span written as a Go duration (e.g. 30s) or as plain seconds
+*/
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := parseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = parsed
+	return nil
+}
+
+func parseDuration(raw string) (Duration, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return Duration(time.Duration(seconds) * time.Second), nil
+	}
+	duration, err := time.ParseDuration(raw)
+	return Duration(duration), err
+}
+
+/*
+Default returns the configuration used for everything not set in the file or the environment
+*/
+func Default() *Config {
+	return &Config{
+		Seeds:   []string{"wss://relay.artiostr.ch/", "wss://relay.artio.inf.unibe.ch/"},
+		Storage: Storage{Backend: "neo4j"},
+		Crawl: Crawl{
+			MaxRunners:       1,
+			Nip11Timeout:     Duration(time.Second),
+			RelayListTimeout: Duration(30 * time.Second),
+			ProbeTimeout:     Duration(10 * time.Second),
+		},
+		Monitor: Monitor{Interval: Duration(time.Hour)},
+		Output:  Output{Reports: true, OperatorMinRelays: 2},
+		Log:     Log{Format: "text", Level: "info"},
+	}
+}
+
+/*
+Load reads the configuration file at path on top of the defaults and applies the environment overrides
+an empty path only uses the defaults and the environment, all problems are returned together
+*/
+func Load(path string) (*Config, error) {
+	config := Default()
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	err := errors.Join(applyEnv(reflect.ValueOf(config).Elem(), os.LookupEnv), config.Validate())
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+/*
+Validate checks the configuration for values the miner cannot work with
+*/
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Storage.Backend != "neo4j" {
+		errs = append(errs, fmt.Errorf("storage.backend: unsupported backend %q", c.Storage.Backend))
+	}
+	if c.Crawl.MaxRecursion < 0 {
+		errs = append(errs, errors.New("crawl.maxRecursion: must not be negative"))
+	}
+	if c.Crawl.MaxRunners < 1 {
+		errs = append(errs, errors.New("crawl.maxRunners: at least one runner is required"))
+	}
+	if c.Crawl.RateLimit < 0 {
+		errs = append(errs, errors.New("crawl.rateLimit: must not be negative"))
+	}
+	for name, timeout := range map[string]Duration{"crawl.nip11Timeout": c.Crawl.Nip11Timeout, "crawl.relayListTimeout": c.Crawl.RelayListTimeout, "crawl.probeTimeout": c.Crawl.ProbeTimeout} {
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be positive", name))
+		}
+	}
+	if c.Probes.MaxEnrichedUsers < 0 {
+		errs = append(errs, errors.New("probes.maxEnrichedUsers: must not be negative"))
+	}
+	if c.Network.Socks5Proxy != "" && !strings.HasPrefix(c.Network.Socks5Proxy, "socks5://") && !strings.HasPrefix(c.Network.Socks5Proxy, "socks5h://") {
+		errs = append(errs, errors.New("network.socks5Proxy: must be a socks5:// URL"))
+	}
+	if _, err := policy.New(c.Policy.Allow, c.Policy.Deny); err != nil {
+		errs = append(errs, fmt.Errorf("policy: %w", err))
+	}
+	if (c.Monitor.PrivateKey == "") != (len(c.Monitor.Relays) == 0) {
+		errs = append(errs, errors.New("monitor: privateKey and relays must be set together"))
+	}
+	if c.Monitor.Concurrency < 0 {
+		errs = append(errs, errors.New("monitor.concurrency: must not be negative"))
+	}
+	if c.Monitor.Interval <= 0 {
+		// a cycle would start right after the previous one and re-probe every relay in a tight loop
+		errs = append(errs, errors.New("monitor.interval: must be positive"))
+	}
+	if c.Monitor.Jitter < 0 || (c.Monitor.Interval > 0 && c.Monitor.Jitter >= c.Monitor.Interval) {
+		errs = append(errs, errors.New("monitor.jitter: must not be negative and smaller than monitor.interval"))
+	}
+	if _, err := logging.New(io.Discard, c.Log.Format, c.Log.Level, c.Log.Quiet); err != nil {
+		errs = append(errs, fmt.Errorf("log: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+/*
+Print writes the configuration as YAML with the secrets masked
+*/
+func (c *Config) Print(w io.Writer) error {
+	masked := *c
+	maskSecrets(reflect.ValueOf(&masked).Elem())
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(&masked)
+}
+
+func maskSecrets(value reflect.Value) {
+	for i := range value.NumField() {
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct {
+			maskSecrets(field)
+			continue
+		}
+		if value.Type().Field(i).Tag.Get("secret") == "true" && field.String() != "" {
+			field.SetString("********")
+		}
+	}
+}
+
+/*
+applyEnv overrides the fields with the environment variable named in their env tag
+durations are given as Go durations (e.g. 30s) or as plain seconds
+*/
+func applyEnv(value reflect.Value, lookup func(string) (string, bool)) error {
+	var errs []error
+	for i := range value.NumField() {
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, applyEnv(field, lookup))
+			continue
+		}
+		name := value.Type().Field(i).Tag.Get("env")
+		raw, ok := lookup(name)
+		if name == "" || !ok || raw == "" {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%q: %w", name, raw, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == reflect.TypeOf(Duration(0)) {
+		duration, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int:
+		number, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(number))
+	case reflect.Float64:
+		number, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(number)
+	case reflect.Bool:
+		flag, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(flag)
+	case reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+TestLoad tests reading the configuration file with environment overrides and up front validation
+*/
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		check   func(*Config) bool
+		wantErr string
+	}{
+		{
+			name: "Load_File",
+			file: "storage:\n  uri: neo4j://localhost\ncrawl:\n  maxRunners: 4\n  probeTimeout: 5s\n  relayListTimeout: 20\n",
+			check: func(c *Config) bool {
+				return c.Crawl.MaxRunners == 4 && c.Crawl.ProbeTimeout == Duration(5*time.Second) && c.Crawl.RelayListTimeout == Duration(20*time.Second)
+			},
+		},
+		{
+			name: "Load_EnvOverride",
+			file: "storage:\n  uri: neo4j://localhost\ncrawl:\n  maxRunners: 4\n",
+			env:  map[string]string{"MAX_RUNNERS": "8", "SEEDS": "wss://a.example.com, wss://b.example.com", "MONITOR_INTERVAL": "90"},
+			check: func(c *Config) bool {
+				return c.Crawl.MaxRunners == 8 && len(c.Seeds) == 2 && c.Monitor.Interval == Duration(90*time.Second)
+			},
+		},
+		{
+			name:    "Load_UnknownField",
+			file:    "storage:\n  uri: neo4j://localhost\ncrawl:\n  maxRunner: 4\n",
+			wantErr: "field maxRunner not found",
+		},
+		{
+			name:    "Load_InvalidEnv",
+			file:    "storage:\n  uri: neo4j://localhost\n",
+			env:     map[string]string{"MAX_RUNNERS": "many"},
+			wantErr: "MAX_RUNNERS",
+		},
+		{
+			name:    "Load_Invalid",
+			file:    "storage:\n  backend: sqlite\ncrawl:\n  maxRunners: 0\npolicy:\n  deny: [\"10.0.0.0/33\"]\n",
+			wantErr: "storage.backend: unsupported backend \"sqlite\"\ncrawl.maxRunners: at least one runner is required\npolicy: rule",
+		},
+		{
+			name:    "Load_ZeroInterval",
+			file:    "storage:\n  uri: neo4j://localhost\n",
+			env:     map[string]string{"MONITOR_INTERVAL": "0"},
+			wantErr: "monitor.interval: must be positive",
+		},
+		{
+			name:    "Load_NegativeInterval",
+			file:    "monitor:\n  interval: -5m\n",
+			wantErr: "monitor.interval: must be positive",
+		},
+		{
+			name:    "Load_NegativeJitter",
+			file:    "monitor:\n  jitter: -1s\n",
+			wantErr: "monitor.jitter: must not be negative and smaller than monitor.interval",
+		},
+		{
+			name:    "Load_JitterAboveInterval",
+			file:    "monitor:\n  interval: 1m\n  jitter: 2m\n",
+			wantErr: "monitor.jitter: must not be negative and smaller than monitor.interval",
+		},
+		{
+			name: "Load_Jitter",
+			file: "monitor:\n  interval: 10m\n  jitter: 1m\n",
+			check: func(c *Config) bool {
+				return c.Monitor.Interval == Duration(10*time.Minute) && c.Monitor.Jitter == Duration(time.Minute)
+			},
+		},
+		{
+			name:    "Load_InvalidLog",
+			file:    "log:\n  format: xml\n",
+			wantErr: "log: unknown log format \"xml\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			config, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !tt.check(config) {
+				t.Errorf("Load() = %+v", config)
+			}
+		})
+	}
+}
+
+/*
+TestPrint tests that the secrets are masked in the printed configuration
+*/
+func TestPrint(t *testing.T) {
+	config := Default()
+	config.Storage.Password = "hunter2"
+	var out strings.Builder
+	if err := config.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") || !strings.Contains(out.String(), "probeTimeout: 10s") {
+		t.Errorf("Print() = %v", out.String())
+	}
+	if config.Storage.Password != "hunter2" {
+		t.Errorf("Print() changed the configuration")
+	}
+}
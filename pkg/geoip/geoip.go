@@ -0,0 +1,108 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+/*
+Databases holds the local MaxMind-format City and ASN databases, either of them may be missing
+*/
+type Databases struct {
+	city *maxminddb.Reader
+	asn  *maxminddb.Reader
+}
+
+/*
+Location is the geographic and network information of an IP address, empty fields were not found
+*/
+type Location struct {
+	CountryCode  string
+	CountryName  string
+	City         string
+	ASN          uint
+	Organisation string
+}
+
+/*
+cityRecord is the part of a GeoLite2 City record we read
+*/
+type cityRecord struct {
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+/*
+asnRecord is a GeoLite2 ASN record
+*/
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organisation string `maxminddb:"autonomous_system_organization"`
+}
+
+/*
+Open opens the City and ASN databases at the given paths, an empty path skips the database
+*/
+func Open(cityPath string, asnPath string) (*Databases, error) {
+	if cityPath == "" && asnPath == "" {
+		return nil, errors.New("no GeoIP database configured")
+	}
+	db := &Databases{}
+	var err error
+	if cityPath != "" {
+		if db.city, err = maxminddb.Open(cityPath); err != nil {
+			return nil, err
+		}
+	}
+	if asnPath != "" {
+		if db.asn, err = maxminddb.Open(asnPath); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+/*
+Close closes the opened databases
+*/
+func (db *Databases) Close() {
+	if db.city != nil {
+		db.city.Close()
+	}
+	if db.asn != nil {
+		db.asn.Close()
+	}
+}
+
+/*
+Lookup returns the location of the IP address, addresses not in the databases give an empty location
+*/
+func (db *Databases) Lookup(ip net.IP) (*Location, error) {
+	location := &Location{}
+	if db.city != nil {
+		var record cityRecord
+		if err := db.city.Lookup(ip, &record); err != nil {
+			return nil, err
+		}
+		location.CountryCode = record.Country.IsoCode
+		location.CountryName = record.Country.Names["en"]
+		location.City = record.City.Names["en"]
+	}
+	if db.asn != nil {
+		var record asnRecord
+		if err := db.asn.Lookup(ip, &record); err != nil {
+			return nil, err
+		}
+		location.ASN = record.Number
+		location.Organisation = record.Organisation
+	}
+	return location, nil
+}
@@ -0,0 +1,28 @@
+package geoip
+
+import (
+	"testing"
+)
+
+/*
+TestOpen tests that missing databases are reported
+*/
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		cityPath string
+		asnPath  string
+	}{
+		{name: "Open_NoPaths", cityPath: "", asnPath: ""},
+		{name: "Open_MissingCity", cityPath: "does-not-exist.mmdb", asnPath: ""},
+		{name: "Open_MissingAsn", cityPath: "", asnPath: "does-not-exist.mmdb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if db, err := Open(tt.cityPath, tt.asnPath); err == nil {
+				db.Close()
+				t.Errorf("Open() expected an error")
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package helper
 import (
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
 /*
@@ -24,11 +26,12 @@ func CleanRelayName(name string) string {
 
 /*
 FindRelayForUser parses a list of nostr.Event to find all relays that are used by another user.
+the events come from untrusted relays, tags without a value are skipped
 */
 func FindRelayForUser(event *nostr.Event) (string, []string) {
 	var relays []string
 	for _, tag := range event.Tags {
-		if tagType := tag[0]; tagType == "r" {
+		if len(tag) >= 2 && tag[0] == "r" {
 			relays = append(relays, tag[1])
 		}
 	}
@@ -64,16 +67,130 @@ func ValidateURL(uri string) (bool, string) {
 }
 
 /*
-ValidateDNS resolves a hostname to an IP address
+NormalizeSoftware normalises a NIP-11 software identifier, so that git URLs, npm names and trailing slashes of the same project match
 */
-func ValidateDNS(hostname string) ([]net.IP, string) {
-	var result []net.IP
-	ips, err := net.LookupIP(hostname)
-	if err != nil {
-		return result, "DNS resolution failed"
+func NormalizeSoftware(software string) string {
+	software = strings.ToLower(strings.TrimSpace(software))
+	for _, prefix := range []string{"git+", "https://", "http://", "git://", "ssh://", "git@", "www."} {
+		software = strings.TrimPrefix(software, prefix)
+	}
+	// scp like git urls, e.g. github.com:hoytech/strfry
+	if host, path, found := strings.Cut(software, ":"); found && strings.Contains(host, ".") && !strings.HasPrefix(path, "//") {
+		software = host + "/" + path
+	}
+	software = strings.TrimRight(software, "/")
+	software = strings.TrimSuffix(software, ".git")
+	if pkg, found := strings.CutPrefix(software, "npmjs.com/package/"); found {
+		software = "npm:" + pkg
+	}
+	return software
+}
+
+/*
+Semver holds the parts of a semantic version
+*/
+type Semver struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+/*
+ParseSemver parses a version string as semantic version, missing minor or patch numbers are read as 0
+*/
+func ParseSemver(version string) (Semver, bool) {
+	var result Semver
+	version = strings.TrimSpace(version)
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+	version, result.Build, _ = strings.Cut(version, "+")
+	version, result.Prerelease, _ = strings.Cut(version, "-")
+	parts := strings.Split(version, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return Semver{}, false
+	}
+	numbers := []*int{&result.Major, &result.Minor, &result.Patch}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return Semver{}, false
+		}
+		*numbers[i] = number
+	}
+	return result, true
+}
+
+/*
+NetworkType returns the NIP-66 network of a relay, one of clearnet, tor, i2p or loki
+*/
+func NetworkType(relay string) string {
+	host := CleanRelayName(relay)
+	if c, err := url.Parse(relay); err == nil && c.Hostname() != "" {
+		host = c.Hostname()
+	}
+	host = strings.ToLower(host)
+	switch {
+	case strings.HasSuffix(host, ".onion"):
+		return "tor"
+	case strings.HasSuffix(host, ".i2p"):
+		return "i2p"
+	case strings.HasSuffix(host, ".loki"):
+		return "loki"
+	}
+	return "clearnet"
+}
+
+/*
+NormalizePubKey returns the 64 character hex form of a pubkey given as hex or npub, the boolean is false for invalid keys
+*/
+func NormalizePubKey(pubKey string) (string, bool) {
+	pubKey = strings.ToLower(strings.TrimSpace(pubKey))
+	if strings.HasPrefix(pubKey, "npub1") {
+		prefix, value, err := nip19.Decode(pubKey)
+		if err != nil || prefix != "npub" {
+			return "", false
+		}
+		pubKey, _ = value.(string)
+	}
+	if !nostr.IsValid32ByteHex(pubKey) {
+		return "", false
+	}
+	return pubKey, true
+}
+
+/*
+NormalizeRelayURL brings a relay URL into a canonical form for deduplication
+the scheme and host are lowercased, http(s) is mapped to ws(s), a missing scheme becomes wss, default ports, query, fragment and trailing slashes are dropped
+*/
+func NormalizeRelayURL(relay string) (string, bool) {
+	relay = strings.TrimSpace(relay)
+	if relay == "" {
+		return "", false
+	}
+	if !strings.Contains(relay, "://") {
+		relay = "wss://" + relay
+	}
+	u, err := url.Parse(relay)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "https":
+		scheme = "wss"
+	case "http":
+		scheme = "ws"
+	case "ws", "wss":
+	default:
+		return "", false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
 	}
-	for _, ip := range ips {
-		result = append(result, ip)
+	if port := u.Port(); port != "" && !(scheme == "wss" && port == "443") && !(scheme == "ws" && port == "80") {
+		host += ":" + port
 	}
-	return result, ""
+	return scheme + "://" + host + strings.TrimRight(u.EscapedPath(), "/"), true
 }
@@ -3,6 +3,7 @@ package helper
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -49,6 +50,14 @@ func TestFindRelayForUser(t *testing.T) {
 			nostr.Tag{"r", "wss://relay2.com/"},
 		},
 	}
+	malformedEvent := &nostr.Event{
+		PubKey: "testpubkey",
+		Tags: nostr.Tags{
+			nostr.Tag{},
+			nostr.Tag{"r"},
+			nostr.Tag{"r", "wss://relay1.com/", "write"},
+		},
+	}
 	tests := []struct {
 		name  string
 		args  args
@@ -56,6 +65,7 @@ func TestFindRelayForUser(t *testing.T) {
 		want1 []string
 	}{
 		{name: "FindRelayForUser_EmptyEvent", args: args{event: emptyEvent}, want: "", want1: []string{}},
+		{name: "FindRelayForUser_MalformedTags", args: args{event: malformedEvent}, want: "testpubkey", want1: []string{"wss://relay1.com/"}},
 		{name: "FindRelayForUser_FullEvent", args: args{event: populatedEvent}, want: "testpubkey", want1: []string{"wss://relay1.com/", "wss://relay2.com/"}},
 	}
 	for _, tt := range tests {
@@ -102,3 +112,136 @@ func TestValidateURL(t *testing.T) {
 		}
 	}
 }
+
+/*
+TestNormalizeSoftware tests the NormalizeSoftware function and its output
+*/
+func TestNormalizeSoftware(t *testing.T) {
+	tests := []struct {
+		name     string
+		software string
+		want     string
+	}{
+		{name: "NormalizeSoftware_Https", software: "https://github.com/hoytech/strfry", want: "github.com/hoytech/strfry"},
+		{name: "NormalizeSoftware_TrailingSlash", software: "https://github.com/hoytech/strfry/", want: "github.com/hoytech/strfry"},
+		{name: "NormalizeSoftware_GitSuffix", software: "git+https://github.com/scsibug/nostr-rs-relay.git", want: "github.com/scsibug/nostr-rs-relay"},
+		{name: "NormalizeSoftware_Scp", software: "git@github.com:hoytech/strfry.git", want: "github.com/hoytech/strfry"},
+		{name: "NormalizeSoftware_Npm", software: "https://www.npmjs.com/package/nostream", want: "npm:nostream"},
+		{name: "NormalizeSoftware_Case", software: " GitHub.com/Hoytech/Strfry ", want: "github.com/hoytech/strfry"},
+		{name: "NormalizeSoftware_Plain", software: "khatru", want: "khatru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeSoftware(tt.software); got != tt.want {
+				t.Errorf("NormalizeSoftware(%v) = %v, want %v", tt.software, got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestParseSemver tests the ParseSemver function and its output
+*/
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    Semver
+		wantOk  bool
+	}{
+		{name: "ParseSemver_Full", version: "1.2.3", want: Semver{Major: 1, Minor: 2, Patch: 3}, wantOk: true},
+		{name: "ParseSemver_Prefix", version: "v0.9.6", want: Semver{Major: 0, Minor: 9, Patch: 6}, wantOk: true},
+		{name: "ParseSemver_Prerelease", version: "1.0.0-rc.1+abc", want: Semver{Major: 1, Prerelease: "rc.1", Build: "abc"}, wantOk: true},
+		{name: "ParseSemver_Short", version: "2.1", want: Semver{Major: 2, Minor: 1}, wantOk: true},
+		{name: "ParseSemver_Hash", version: "d8f3a1c", want: Semver{}, wantOk: false},
+		{name: "ParseSemver_Empty", version: "", want: Semver{}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOk := ParseSemver(tt.version)
+			if got != tt.want || gotOk != tt.wantOk {
+				t.Errorf("ParseSemver(%v) = %v with %v, want %v with %v", tt.version, got, gotOk, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+/*
+TestNetworkType tests the NetworkType function and its output
+*/
+func TestNetworkType(t *testing.T) {
+	tests := []struct {
+		name  string
+		relay string
+		want  string
+	}{
+		{name: "NetworkType_Clearnet", relay: "wss://relay.relay.com/", want: "clearnet"},
+		{name: "NetworkType_Tor", relay: "ws://ex3znuu3kt4se7fjhc2l7zbjv2ydsajqi5suegk3gpfuqlzdgtl4f3qd.onion/", want: "tor"},
+		{name: "NetworkType_I2p", relay: "ws://relay.i2p", want: "i2p"},
+		{name: "NetworkType_NoScheme", relay: "relay.i2p", want: "i2p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NetworkType(tt.relay); got != tt.want {
+				t.Errorf("NetworkType(%v) = %v, want %v", tt.relay, got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestNormalizePubKey tests the NormalizePubKey function and its output
+*/
+func TestNormalizePubKey(t *testing.T) {
+	hex := "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+	tests := []struct {
+		name   string
+		pubKey string
+		want   string
+		wantOk bool
+	}{
+		{name: "NormalizePubKey_Hex", pubKey: hex, want: hex, wantOk: true},
+		{name: "NormalizePubKey_Upper", pubKey: " " + strings.ToUpper(hex) + " ", want: hex, wantOk: true},
+		{name: "NormalizePubKey_Npub", pubKey: "npub180cvv07tjdrrgpa0j7j7tmnyl2yr6yr7l8j4s3evf6u64th6gkwsyjh6w6", want: hex, wantOk: true},
+		{name: "NormalizePubKey_Empty", pubKey: "", want: "", wantOk: false},
+		{name: "NormalizePubKey_Short", pubKey: "3bf0c63f", want: "", wantOk: false},
+		{name: "NormalizePubKey_BadNpub", pubKey: "npub1invalid", want: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, gotOk := NormalizePubKey(tt.pubKey); got != tt.want || gotOk != tt.wantOk {
+				t.Errorf("NormalizePubKey(%v) = %v with %v, want %v with %v", tt.pubKey, got, gotOk, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+/*
+TestNormalizeRelayURL tests the NormalizeRelayURL function and its output
+*/
+func TestNormalizeRelayURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		relay  string
+		want   string
+		wantOk bool
+	}{
+		{name: "NormalizeRelayURL_Plain", relay: "wss://relay.damus.io", want: "wss://relay.damus.io", wantOk: true},
+		{name: "NormalizeRelayURL_TrailingSlash", relay: " wss://Relay.Damus.io/ ", want: "wss://relay.damus.io", wantOk: true},
+		{name: "NormalizeRelayURL_DefaultPort", relay: "wss://relay.damus.io:443/", want: "wss://relay.damus.io", wantOk: true},
+		{name: "NormalizeRelayURL_Port", relay: "ws://relay.example.com:7777", want: "ws://relay.example.com:7777", wantOk: true},
+		{name: "NormalizeRelayURL_Path", relay: "wss://relay.example.com/nostr/?x=1#top", want: "wss://relay.example.com/nostr", wantOk: true},
+		{name: "NormalizeRelayURL_NoScheme", relay: "relay.example.com", want: "wss://relay.example.com", wantOk: true},
+		{name: "NormalizeRelayURL_Https", relay: "https://relay.example.com", want: "wss://relay.example.com", wantOk: true},
+		{name: "NormalizeRelayURL_IPv6", relay: "ws://[2001:db8::1]:80/", want: "ws://[2001:db8::1]", wantOk: true},
+		{name: "NormalizeRelayURL_OtherScheme", relay: "ftp://relay.example.com", want: "", wantOk: false},
+		{name: "NormalizeRelayURL_Empty", relay: "", want: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, gotOk := NormalizeRelayURL(tt.relay); got != tt.want || gotOk != tt.wantOk {
+				t.Errorf("NormalizeRelayURL(%v) = %v with %v, want %v with %v", tt.relay, got, gotOk, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+/*
+Levels above slog.LevelError, both are reported in quiet mode
+*/
+const (
+	LevelSummary = slog.Level(12) // the summaries at the end of a crawl or monitor cycle
+	LevelFatal   = slog.Level(16) // errors the command exits on
+)
+
+/*
+New creates a logger writing text or JSON to w from the given level on
+in quiet mode only the summaries and fatal errors are written
+*/
+func New(w io.Writer, format string, level string, quiet bool) (*slog.Logger, error) {
+	minimum, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if quiet {
+		minimum = LevelSummary
+	}
+	options := &slog.HandlerOptions{Level: minimum, ReplaceAttr: replaceLevel}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+}
+
+/*
+ParseLevel parses debug, info, warn or error, an empty level is info
+*/
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return parsed, fmt.Errorf("unknown log level %q, use debug, info, warn or error", level)
+	}
+	return parsed, nil
+}
+
+/*
+Summary logs a summary that is kept in quiet mode
+*/
+func Summary(logger *slog.Logger, message string, args ...any) {
+	logger.Log(context.Background(), LevelSummary, message, args...)
+}
+
+/*
+Fatal logs an error the command exits on, it is kept in quiet mode
+*/
+func Fatal(logger *slog.Logger, message string, args ...any) {
+	logger.Log(context.Background(), LevelFatal, message, args...)
+}
+
+/*
+replaceLevel names the summary and fatal levels instead of printing them as ERROR+4 and ERROR+8
+*/
+func replaceLevel(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := attr.Value.Any().(slog.Level); ok {
+			switch level {
+			case LevelSummary:
+				return slog.String(slog.LevelKey, "SUMMARY")
+			case LevelFatal:
+				return slog.String(slog.LevelKey, "FATAL")
+			}
+		}
+	}
+	return attr
+}
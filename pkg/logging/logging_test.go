@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+/*
+TestNew tests the levels, formats and the quiet mode of the loggers
+*/
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		level   string
+		quiet   bool
+		want    []string
+		notWant []string
+		wantErr bool
+	}{
+		{name: "New_Text", format: "text", level: "info", want: []string{"level=INFO msg=info relay=wss://relay.example.com", "level=SUMMARY msg=summary"}, notWant: []string{"msg=debug"}},
+		{name: "New_Json", format: "json", level: "debug", want: []string{`"level":"DEBUG","msg":"debug"`, `"level":"SUMMARY"`}},
+		{name: "New_Level", format: "text", level: "WARN", want: []string{"msg=warn"}, notWant: []string{"msg=info"}},
+		{name: "New_Quiet", format: "text", level: "debug", quiet: true, want: []string{"level=SUMMARY msg=summary", "level=FATAL msg=fatal"}, notWant: []string{"msg=debug", "msg=info", "msg=warn", "msg=error"}},
+		{name: "New_UnknownFormat", format: "xml", wantErr: true},
+		{name: "New_UnknownLevel", format: "text", level: "verbose", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger, err := New(&out, tt.format, tt.level, tt.quiet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			logger = logger.With(slog.String("relay", "wss://relay.example.com"))
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+			logger.Error("error")
+			Summary(logger, "summary")
+			Fatal(logger, "fatal")
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("New() output %q does not contain %q", out.String(), want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("New() output %q contains %q", out.String(), notWant)
+				}
+			}
+		})
+	}
+}
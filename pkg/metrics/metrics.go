@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+Collectors of the miner, exposed on /metrics by Handler
+the error counters are labelled with the error classes of the probe result
+*/
+var (
+	QueueLength = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "artio_queue_length",
+		Help: "Number of relays waiting to be mined.",
+	})
+	Runners = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "artio_runners",
+		Help: "Number of runners by state, busy or idle.",
+	}, []string{"state"})
+	RelaysProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "artio_relays_processed_total",
+		Help: "Number of relays processed by validity and the reason they are invalid.",
+	}, []string{"valid", "reason"})
+	EventsFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "artio_events_fetched_total",
+		Help: "Number of events received from relays by stage.",
+	}, []string{"stage"})
+	WebsocketErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "artio_websocket_errors_total",
+		Help: "Number of failed websocket connections by error class.",
+	}, []string{"class"})
+	HTTPErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "artio_http_errors_total",
+		Help: "Number of failed NIP-11 requests by error class.",
+	}, []string{"class"})
+	StorageWriteSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "artio_storage_write_seconds",
+		Help:    "Latency of the writes to the database.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+	StorageBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "artio_storage_batch_size",
+		Help:    "Number of nodes, relationships and properties changed by a single write.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+	StageSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "artio_stage_duration_seconds",
+		Help:    "Duration of the stages of mining a relay.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"stage"})
+)
+
+/*
+RunnerState tracks the state of a runner in the Runners gauge, a new runner is idle
+*/
+type RunnerState struct {
+	state string
+}
+
+/*
+NewRunnerState counts a new idle runner
+*/
+func NewRunnerState() *RunnerState {
+	Runners.WithLabelValues("idle").Inc()
+	return &RunnerState{state: "idle"}
+}
+
+/*
+Set moves the runner to the state, busy or idle
+*/
+func (s *RunnerState) Set(state string) {
+	if state == s.state {
+		return
+	}
+	Runners.WithLabelValues(s.state).Dec()
+	Runners.WithLabelValues(state).Inc()
+	s.state = state
+}
+
+/*
+Done removes the stopped runner from the gauge
+*/
+func (s *RunnerState) Done() {
+	Runners.WithLabelValues(s.state).Dec()
+}
+
+/*
+Handler returns the HTTP handler exposing the metrics in the Prometheus text format
+*/
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
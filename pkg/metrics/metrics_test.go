@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*
+TestHandler tests the runner and queue gauges scraped while a stubbed crawl runs and after it ended
+*/
+func TestHandler(t *testing.T) {
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		return recorder.Body.String()
+	}
+
+	// two runners of a crawl with three queued relays, one of them picks up a relay
+	first, second := NewRunnerState(), NewRunnerState()
+	QueueLength.Set(3)
+	first.Set("busy")
+	QueueLength.Set(2)
+	WebsocketErrors.WithLabelValues("tcp_refused").Inc()
+	HTTPErrors.WithLabelValues("http_5xx").Inc()
+	running := scrape()
+
+	first.Set("idle")
+	QueueLength.Set(0)
+	first.Done()
+	second.Done()
+	stopped := scrape()
+
+	tests := []struct {
+		name    string
+		scraped string
+		want    []string
+	}{
+		{name: "Handler_Running", scraped: running, want: []string{
+			`artio_runners{state="busy"} 1`, `artio_runners{state="idle"} 1`, "artio_queue_length 2",
+			`artio_websocket_errors_total{class="tcp_refused"} 1`, `artio_http_errors_total{class="http_5xx"} 1`,
+		}},
+		{name: "Handler_Stopped", scraped: stopped, want: []string{
+			`artio_runners{state="busy"} 0`, `artio_runners{state="idle"} 0`, "artio_queue_length 0",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, line := range tt.want {
+				if !strings.Contains(tt.scraped, line+"\n") {
+					t.Errorf("Handler() is missing %v", line)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package miner
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+Methods used to estimate the number of events of a kind
+*/
+const (
+	CensusMethodCount  = "count"  // NIP-45 COUNT reported by the relay
+	CensusMethodSample = "sample" // bounded REQ, counts at the limit are capped
+)
+
+/*
+censusSampleLimit is the maximum number of events requested per kind and bucket without NIP-45
+*/
+const censusSampleLimit = 500
+
+/*
+censusCategories maps the kinds of the census to the category of relay they indicate
+*/
+var censusCategories = map[int]string{
+	0:     "social",
+	1:     "social",
+	3:     "social",
+	6:     "social",
+	7:     "social",
+	1111:  "social",
+	4:     "dm",
+	14:    "dm",
+	1059:  "dm",
+	30023: "long-form",
+	30024: "long-form",
+	30017: "marketplace",
+	30018: "marketplace",
+	30402: "marketplace",
+	9734:  "zaps",
+	9735:  "zaps",
+	20:    "media",
+	21:    "media",
+	1063:  "media",
+}
+
+/*
+censusBuckets are the time buckets events are counted in, a zero duration counts all events
+*/
+var censusBuckets = []struct {
+	Name   string
+	Window time.Duration
+}{
+	{Name: "24h", Window: 24 * time.Hour},
+	{Name: "7d", Window: 7 * 24 * time.Hour},
+	{Name: "30d", Window: 30 * 24 * time.Hour},
+	{Name: "all", Window: 0},
+}
+
+/*
+KindCount holds the estimated number of events of a kind on a relay within a time bucket
+*/
+type KindCount struct {
+	Kind   int
+	Bucket string
+	Count  int64
+	Method string
+	Capped bool // the sample hit the limit, the relay holds at least Count events
+}
+
+/*
+LoadCensus estimates the number of events per kind and time bucket on the relay
+NIP-45 COUNT is used if the relay advertises it, otherwise or if it is refused bounded REQs are sampled
+a census aborted by an error or a refusal is dropped, the buckets counted so far do not describe the relay
+*/
+func (rm *RelayMiner) LoadCensus() {
+	rc, err := connectRelay(rm.Relay, "census")
+	if err != nil {
+		rm.fail(ClassifyError(err), err.Error())
+		rm.logger().Warn("census failed", "error", err)
+		return
+	}
+	defer func() { rc.Close() }()
+
+	useCount := slices.Contains(rm.SupportedNips(), 45)
+	kinds := make([]int, 0, len(censusCategories))
+	for kind := range censusCategories {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+
+	rm.KindCensus = make([]*KindCount, 0)
+	now := time.Now()
+	for _, kind := range kinds {
+		for _, bucket := range censusBuckets {
+			filter := nostr.Filter{Kinds: []int{kind}}
+			if bucket.Window > 0 {
+				since := nostr.Timestamp(now.Add(-bucket.Window).Unix())
+				filter.Since = &since
+			}
+			result := &KindCount{Kind: kind, Bucket: bucket.Name}
+			if useCount {
+				count, reason, err := rc.count("census", filter, probeTimeout)
+				if err == nil && reason == "" {
+					result.Count = count
+					result.Method = CensusMethodCount
+					rm.KindCensus = append(rm.KindCensus, result)
+					continue
+				}
+				if err != nil && !errors.Is(err, errNoResponse) {
+					rm.KindCensus = nil
+					rm.fail(ClassifyError(err), err.Error())
+					rm.logger().Warn("census failed", "kind", kind, "bucket", bucket.Name, "error", err)
+					return
+				}
+				// the relay refused COUNT, fall back to sampling for the remaining requests
+				useCount = false
+				if err != nil {
+					// a timed out connection cannot be read from again
+					reconnected, err := connectRelay(rm.Relay, "census")
+					if err != nil {
+						rm.KindCensus = nil
+						rm.fail(ClassifyError(err), err.Error())
+						rm.logger().Warn("census failed on reconnecting", "kind", kind, "bucket", bucket.Name, "error", err)
+						return
+					}
+					rc.Close()
+					rc = reconnected
+				}
+			}
+			filter.Limit = censusSampleLimit
+			events, reason, err := rc.query("census", filter, probeTimeout)
+			if err != nil {
+				rm.KindCensus = nil
+				rm.fail(ClassifyError(err), err.Error())
+				rm.logger().Warn("census failed", "kind", kind, "bucket", bucket.Name, "error", err)
+				return
+			}
+			if reason != "" {
+				// a refused sample is not an empty relay
+				class := ErrorClosedByRelay
+				if IsAuthRequiredMessage(reason) {
+					class = ErrorAuthRequired
+				}
+				rm.KindCensus = nil
+				rm.fail(class, reason)
+				rm.logger().Warn("census refused", "kind", kind, "bucket", bucket.Name, "reason", reason)
+				return
+			}
+			result.Count = int64(len(events))
+			result.Method = CensusMethodSample
+			result.Capped = len(events) >= censusSampleLimit
+			rm.KindCensus = append(rm.KindCensus, result)
+		}
+	}
+}
+
+/*
+ClassifyRelay returns the category with the most events over all time, "empty" if no events were found
+*/
+func ClassifyRelay(census []*KindCount) string {
+	totals := make(map[string]int64)
+	for _, count := range census {
+		if count.Bucket != "all" {
+			continue
+		}
+		totals[censusCategories[count.Kind]] += count.Count
+	}
+	category, best := "empty", int64(0)
+	for _, name := range []string{"social", "dm", "long-form", "marketplace", "zaps", "media"} {
+		if totals[name] > best {
+			category, best = name, totals[name]
+		}
+	}
+	return category
+}
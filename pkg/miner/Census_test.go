@@ -0,0 +1,101 @@
+package miner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+TestClassifyRelay tests the classification of relays by their event census
+*/
+func TestClassifyRelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		census []*KindCount
+		want   string
+	}{
+		{name: "ClassifyRelay_Empty", census: []*KindCount{{Kind: 1, Bucket: "all", Count: 0}}, want: "empty"},
+		{name: "ClassifyRelay_Social", census: []*KindCount{{Kind: 1, Bucket: "all", Count: 400}, {Kind: 7, Bucket: "all", Count: 100}, {Kind: 30023, Bucket: "all", Count: 20}}, want: "social"},
+		{name: "ClassifyRelay_Dm", census: []*KindCount{{Kind: 1059, Bucket: "all", Count: 300}, {Kind: 1, Bucket: "all", Count: 10}, {Kind: 1, Bucket: "24h", Count: 900}}, want: "dm"},
+		{name: "ClassifyRelay_Marketplace", census: []*KindCount{{Kind: 30402, Bucket: "all", Count: 50}, {Kind: 30017, Bucket: "all", Count: 50}, {Kind: 1, Bucket: "all", Count: 60}}, want: "marketplace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyRelay(tt.census); got != tt.want {
+				t.Errorf("ClassifyRelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+closingRelay answers the first REQs with EOSE and the remaining ones with CLOSED and the reason
+an empty reason drops the connection instead
+*/
+func closingRelay(answered int, reason string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			var message []json.RawMessage
+			if err := c.ReadJSON(&message); err != nil {
+				return
+			}
+			var messageType, subscription string
+			if len(message) < 2 || json.Unmarshal(message[0], &messageType) != nil || messageType != "REQ" {
+				continue
+			}
+			_ = json.Unmarshal(message[1], &subscription)
+			switch {
+			case answered > 0:
+				answered--
+				_ = c.WriteJSON([]any{"EOSE", subscription})
+			case reason == "":
+				return
+			default:
+				_ = c.WriteJSON([]any{"CLOSED", subscription, reason})
+			}
+		}
+	}))
+}
+
+/*
+TestLoadCensus_Closed tests that a census refused or aborted by the relay is recorded as failed instead of empty or partial
+*/
+func TestLoadCensus_Closed(t *testing.T) {
+	tests := []struct {
+		name     string
+		answered int
+		reason   string
+		want     string
+	}{
+		{name: "Census_AuthRequired", reason: "auth-required: sign in first", want: ErrorAuthRequired},
+		{name: "Census_Restricted", reason: "restricted: paid relay", want: ErrorClosedByRelay},
+		{name: "Census_RefusedPartial", answered: 3, reason: "rate-limited: slow down", want: ErrorClosedByRelay},
+		{name: "Census_DroppedPartial", answered: 3, want: ErrorClosedByRelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := closingRelay(tt.answered, tt.reason)
+			defer server.Close()
+			rm := NewMiner("ws://" + strings.TrimPrefix(server.URL, "http://"))
+			rm.currentStage = &StageResult{Stage: "census", Status: StageOk}
+			rm.LoadCensus()
+			if rm.KindCensus != nil {
+				t.Errorf("LoadCensus() census = %v, want nil", rm.KindCensus)
+			}
+			if rm.currentStage.Status != StageFailed || rm.currentStage.ErrorClass != tt.want || (tt.reason != "" && rm.currentStage.Error != tt.reason) {
+				t.Errorf("LoadCensus() stage = %+v, want failed with %v", rm.currentStage, tt.want)
+			}
+		})
+	}
+}
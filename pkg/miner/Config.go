@@ -0,0 +1,33 @@
+package miner
+
+import "time"
+
+/*
+nip11Timeout is the time the NIP-11 request of a clearnet relay may take
+*/
+var nip11Timeout = time.Second
+
+/*
+relayListTimeout is the time the relay list request may take before the connection is closed
+*/
+var relayListTimeout = 30 * time.Second
+
+/*
+probeTimeout is the time a single probe request may take
+*/
+var probeTimeout = 10 * time.Second
+
+/*
+SetTimeouts sets the time the NIP-11 request, the relay list request and a single probe request may take, zero keeps the default
+*/
+func SetTimeouts(nip11 time.Duration, relayList time.Duration, probe time.Duration) {
+	if nip11 > 0 {
+		nip11Timeout = nip11
+	}
+	if relayList > 0 {
+		relayListTimeout = relayList
+	}
+	if probe > 0 {
+		probeTimeout = probe
+	}
+}
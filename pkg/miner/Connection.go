@@ -0,0 +1,192 @@
+package miner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/metrics"
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+errNoResponse is returned when the relay did not answer a request in time
+*/
+var errNoResponse = errors.New("no response from relay")
+
+/*
+dialWebsocket opens the websocket connection to a relay, the phases are recorded if timings are given
+*/
+func dialWebsocket(address string, timings *Timings) (*websocket.Conn, error) {
+	ctx := context.Background()
+	if timings != nil {
+		ctx = timings.WithTrace(ctx)
+	}
+	dialer := *websocket.DefaultDialer
+	if proxy := proxyFor(address); proxy != nil {
+		dialer.Proxy = proxy
+		dialer.HandshakeTimeout = 60 * time.Second
+	}
+	c, _, err := dialer.DialContext(ctx, address, nil)
+	if err != nil {
+		metrics.WebsocketErrors.WithLabelValues(ClassifyError(err)).Inc()
+	}
+	if timings != nil && err == nil {
+		timings.Mark(&timings.Upgrade, timings.start)
+	}
+	return c, err
+}
+
+/*
+relayConnection is a synchronous connection to a relay, used by the probes sending one request at a time
+*/
+type relayConnection struct {
+	address   string
+	stage     string // stage the received events are counted for
+	conn      *websocket.Conn
+	mutex     sync.Mutex
+	challenge string // last NIP-42 challenge received from the relay
+	notices   []string
+}
+
+/*
+connectRelay opens a relayConnection to the given address for the stage, e.g. probe or census
+*/
+func connectRelay(address string, stage string) (*relayConnection, error) {
+	c, err := dialWebsocket(address, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &relayConnection{address: address, stage: stage, conn: c}, nil
+}
+
+/*
+Close the connection to the relay
+*/
+func (rc *relayConnection) Close() {
+	_ = rc.conn.Close()
+}
+
+/*
+send writes a single message to the relay
+*/
+func (rc *relayConnection) send(message any) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.conn.WriteJSON(message)
+}
+
+/*
+receive reads the next message from the relay until the deadline, AUTH and NOTICE messages are recorded and skipped
+*/
+func (rc *relayConnection) receive(deadline time.Time) (string, []json.RawMessage, error) {
+	for {
+		_ = rc.conn.SetReadDeadline(deadline)
+		_, message, err := rc.conn.ReadMessage()
+		if err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return "", nil, errNoResponse
+			}
+			return "", nil, err
+		}
+		var response []json.RawMessage
+		var messageType string
+		if err := json.Unmarshal(message, &response); err != nil || len(response) == 0 {
+			continue
+		}
+		_ = json.Unmarshal(response[0], &messageType)
+		if messageType == "AUTH" && len(response) > 1 {
+			_ = json.Unmarshal(response[1], &rc.challenge)
+			continue
+		}
+		if messageType == "NOTICE" && len(response) > 1 {
+			var notice string
+			_ = json.Unmarshal(response[1], &notice)
+			rc.notices = append(rc.notices, notice)
+			continue
+		}
+		return messageType, response, nil
+	}
+}
+
+/*
+query sends a REQ with the filter and collects the events until EOSE
+the reason is set if the relay closed the subscription instead
+*/
+func (rc *relayConnection) query(subscription string, filter nostr.Filter, timeout time.Duration) ([]*nostr.Event, string, error) {
+	events := make([]*nostr.Event, 0)
+	if err := rc.send([]any{"REQ", subscription, filter}); err != nil {
+		return events, "", err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		messageType, response, err := rc.receive(deadline)
+		if err != nil {
+			return events, "", err
+		}
+		if len(response) < 2 || stringAt(response, 1) != subscription {
+			continue
+		}
+		switch messageType {
+		case "EVENT":
+			var event nostr.Event
+			if len(response) > 2 && json.Unmarshal(response[2], &event) == nil {
+				events = append(events, &event)
+				metrics.EventsFetched.WithLabelValues(rc.stage).Inc()
+			}
+		case "EOSE":
+			_ = rc.send([]any{"CLOSE", subscription})
+			return events, "", nil
+		case "CLOSED":
+			return events, stringAt(response, 2), nil
+		}
+	}
+}
+
+/*
+count sends a NIP-45 COUNT with the filter and returns the count reported by the relay
+the reason is set if the relay refused the request with CLOSED
+*/
+func (rc *relayConnection) count(subscription string, filter nostr.Filter, timeout time.Duration) (int64, string, error) {
+	if err := rc.send([]any{"COUNT", subscription, filter}); err != nil {
+		return 0, "", err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		messageType, response, err := rc.receive(deadline)
+		if err != nil {
+			return 0, "", err
+		}
+		if len(response) < 2 || stringAt(response, 1) != subscription {
+			continue
+		}
+		switch messageType {
+		case "COUNT":
+			var result struct {
+				Count *int64 `json:"count"`
+			}
+			if len(response) < 3 || json.Unmarshal(response[2], &result) != nil || result.Count == nil {
+				return 0, "", fmt.Errorf("malformed COUNT response")
+			}
+			return *result.Count, "", nil
+		case "CLOSED":
+			return 0, stringAt(response, 2), nil
+		}
+	}
+}
+
+/*
+stringAt returns the string at the position of a relay message or an empty string
+*/
+func stringAt(response []json.RawMessage, index int) string {
+	var value string
+	if len(response) > index {
+		_ = json.Unmarshal(response[index], &value)
+	}
+	return value
+}
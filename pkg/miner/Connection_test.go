@@ -0,0 +1,91 @@
+package miner
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/metrics"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+/*
+TestDialErrorClass tests the classification of failed websocket connections and their count by class
+*/
+func TestDialErrorClass(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer plain.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		address string
+		want    string
+	}{
+		{name: "Class_Handshake", address: "ws://" + strings.TrimPrefix(plain.URL, "http://"), want: ErrorWsHandshake},
+		{name: "Class_Refused", address: "ws://" + closedAddress, want: ErrorTcpRefused},
+		{name: "Class_Dns", address: "ws://relay.invalid", want: ErrorDnsNxDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := testutil.ToFloat64(metrics.WebsocketErrors.WithLabelValues(tt.want))
+			_, err := dialWebsocket(tt.address, nil)
+			if err == nil {
+				t.Fatalf("dialWebsocket() expected an error")
+			}
+			if got := ClassifyError(err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %v, want %v", err, got, tt.want)
+			}
+			if got := testutil.ToFloat64(metrics.WebsocketErrors.WithLabelValues(tt.want)) - before; got != 1 {
+				t.Errorf("WebsocketErrors{class=%q} grew by %v, want 1", tt.want, got)
+			}
+		})
+	}
+}
+
+/*
+TestQuery_EventsFetched tests that the received events are counted for the stage of the connection, not the subscription
+*/
+func TestQuery_EventsFetched(t *testing.T) {
+	server := stubRelay(func(filter nostr.Filter) []*nostr.Event {
+		return []*nostr.Event{{ID: "a", Kind: 1}, {ID: "b", Kind: 1}}
+	})
+	defer server.Close()
+	tests := []struct {
+		name         string
+		stage        string
+		subscription string
+	}{
+		{name: "Fetched_Probe", stage: "probe", subscription: "search"},
+		{name: "Fetched_Census", stage: "census", subscription: "census"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := testutil.ToFloat64(metrics.EventsFetched.WithLabelValues(tt.stage))
+			rc, err := connectRelay("ws://"+strings.TrimPrefix(server.URL, "http://"), tt.stage)
+			if err != nil {
+				t.Fatalf("connectRelay() error = %v", err)
+			}
+			defer rc.Close()
+			if _, _, err := rc.query(tt.subscription, nostr.Filter{Kinds: []int{1}}, probeTimeout); err != nil {
+				t.Fatalf("query() error = %v", err)
+			}
+			if got := testutil.ToFloat64(metrics.EventsFetched.WithLabelValues(tt.stage)) - before; got != 2 {
+				t.Errorf("EventsFetched{stage=%q} grew by %v, want 2", tt.stage, got)
+			}
+		})
+	}
+	if got := testutil.ToFloat64(metrics.EventsFetched.WithLabelValues("search")); got != 0 {
+		t.Errorf("EventsFetched{stage=\"search\"} = %v, want 0", got)
+	}
+}
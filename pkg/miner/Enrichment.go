@@ -0,0 +1,292 @@
+package miner
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip05"
+)
+
+/*
+enrichmentBatchSize is the number of authors requested in a single REQ
+*/
+const enrichmentBatchSize = 100
+
+/*
+Profile holds the kind 0 metadata of a user
+*/
+type Profile struct {
+	PubKey      string `json:"-"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	About       string `json:"about"`
+	Picture     string `json:"picture"`
+	Nip05       string `json:"nip05"`
+	Lud16       string `json:"lud16"`
+	CreatedAt   int64  `json:"-"`
+}
+
+/*
+Nip05Result holds the resolution of a NIP-05 identifier against /.well-known/nostr.json
+*/
+type Nip05Result struct {
+	Identifier string
+	Domain     string
+	Verified   bool // the document maps the name to the pubkey of the profile
+	Relays     []string
+	Error      string
+}
+
+/*
+ParseProfile reads the metadata from a kind 0 event
+*/
+func ParseProfile(event *nostr.Event) (*Profile, error) {
+	var profile Profile
+	if err := json.Unmarshal([]byte(event.Content), &profile); err != nil {
+		return nil, err
+	}
+	profile.PubKey = event.PubKey
+	profile.CreatedAt = int64(event.CreatedAt)
+	return &profile, nil
+}
+
+/*
+WriteRelays returns the relays a user writes to according to the kind 10002 event
+*/
+func WriteRelays(event *nostr.Event) []string {
+	relays := make([]string, 0)
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "r" {
+			continue
+		}
+		if len(tag) > 2 && tag[2] != "write" {
+			continue
+		}
+		relays = append(relays, tag[1])
+	}
+	return relays
+}
+
+/*
+FetchLatestEvents requests the events of a replaceable kind of the authors from a relay and keeps the newest per author
+*/
+func FetchLatestEvents(relay string, kind int, authors []string) map[string]*nostr.Event {
+	latest := make(map[string]*nostr.Event)
+	if len(authors) == 0 {
+		return latest
+	}
+	rc, err := connectRelay(relay, "enrichment")
+	if err != nil {
+		slog.Warn("fetching events failed", "relay", relay, "kind", kind, "error", err)
+		return latest
+	}
+	defer rc.Close()
+	for start := 0; start < len(authors); start += enrichmentBatchSize {
+		batch := authors[start:min(start+enrichmentBatchSize, len(authors))]
+		events, _, err := rc.query("enrich", nostr.Filter{Kinds: []int{kind}, Authors: batch}, probeTimeout)
+		for _, event := range events {
+			if event.Kind != kind {
+				continue
+			}
+			if ok, _ := event.CheckSignature(); !ok {
+				continue
+			}
+			if current, ok := latest[event.PubKey]; !ok || event.CreatedAt > current.CreatedAt {
+				latest[event.PubKey] = event
+			}
+		}
+		if err != nil {
+			slog.Warn("fetching events failed", "relay", relay, "kind", kind, "error", err)
+			break
+		}
+	}
+	return latest
+}
+
+/*
+FetchProfiles loads the newest kind 0 profile of every user from the relays they write to
+*/
+func FetchProfiles(userRelays map[string][]string) map[string]*Profile {
+	byRelay := make(map[string][]string)
+	for pubkey, relays := range userRelays {
+		// ask at most three relays per user to bound the number of connections
+		for _, relay := range relays[:min(3, len(relays))] {
+			byRelay[relay] = append(byRelay[relay], pubkey)
+		}
+	}
+	profiles := make(map[string]*Profile)
+	for relay, pubkeys := range byRelay {
+		for pubkey, event := range FetchLatestEvents(relay, 0, pubkeys) {
+			if current, ok := profiles[pubkey]; ok && current.CreatedAt >= int64(event.CreatedAt) {
+				continue
+			}
+			if profile, err := ParseProfile(event); err == nil {
+				profiles[pubkey] = profile
+			}
+		}
+	}
+	return profiles
+}
+
+/*
+ResolveNip05 resolves the NIP-05 identifier of a profile and verifies it maps to the pubkey of the profile
+*/
+func ResolveNip05(pubkey string, identifier string) *Nip05Result {
+	identifier = strings.TrimSpace(identifier)
+	result := &Nip05Result{Identifier: nip05.NormalizeIdentifier(identifier), Relays: make([]string, 0)}
+	name, domain, err := nip05.ParseIdentifier(identifier)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Domain = strings.ToLower(domain)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	document, name, err := nip05.Fetch(ctx, identifier)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	mapped, ok := document.Names[name]
+	if !ok {
+		result.Error = "name not found in nostr.json"
+		return result
+	}
+	result.Verified = strings.EqualFold(mapped, pubkey)
+	if !result.Verified {
+		result.Error = "name maps to another pubkey"
+	}
+	result.Relays = append(result.Relays, document.Relays[pubkey]...)
+	return result
+}
+
+/*
+collectUsers remembers the write relays of the users of the relay list events for the enrichment stage
+*/
+func (mgmt *Manager) collectUsers(events []*nostr.Event) {
+	mgmt.usersMutex.Lock()
+	defer mgmt.usersMutex.Unlock()
+	if mgmt.userRelays == nil {
+		mgmt.userRelays = make(map[string][]string)
+	}
+	for _, event := range events {
+		if _, known := mgmt.userRelays[event.PubKey]; !known && mgmt.MaxEnrichedUsers > 0 && len(mgmt.userRelays) >= mgmt.MaxEnrichedUsers {
+			continue
+		}
+		relays := WriteRelays(event)
+		if len(relays) > 0 {
+			mgmt.userRelays[event.PubKey] = relays
+		}
+	}
+}
+
+/*
+enrichUsers fetches the profiles of the collected users, resolves their NIP-05 identifiers and stores the results
+*/
+func (mgmt *Manager) enrichUsers() {
+	mgmt.logger().Info("enriching users", "users", len(mgmt.userRelays))
+	profiles := FetchProfiles(mgmt.userRelays)
+	mgmt.logger().Info("found user profiles", "profiles", len(profiles))
+
+	results := make(map[string]*Nip05Result)
+	var resultsMutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(mgmt.MaxRunners, 1))
+	for pubkey, profile := range profiles {
+		if profile.Nip05 == "" {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(pubkey string, identifier string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result := ResolveNip05(pubkey, identifier)
+			resultsMutex.Lock()
+			defer resultsMutex.Unlock()
+			results[pubkey] = result
+		}(pubkey, profile.Nip05)
+	}
+	wg.Wait()
+
+	for pubkey, profile := range profiles {
+		mgmt.storeProfile(profile)
+		result, ok := results[pubkey]
+		if !ok {
+			continue
+		}
+		params := map[string]any{"pubkey": pubkey, "nip05": result.Identifier, "domain": result.Domain, "verified": result.Verified, "error": result.Error}
+		mgmt.Neo.Execute(`MATCH(u:User) WHERE u.pubkey=$pubkey SET u.nip05=$nip05, u.nip05Domain=$domain, u.nip05Verified=$verified, u.nip05Error=$error`, params)
+		if result.Domain == "" {
+			continue
+		}
+		mgmt.Neo.Execute(`MERGE(d:Domain {name: $domain})`, params)
+		mgmt.Neo.Execute(`MATCH(u:User), (d:Domain) WHERE u.pubkey=$pubkey and d.name=$domain MERGE (u)-[n:NIP05_DOMAIN]->(d) SET n.verified=$verified;`, params)
+		for _, relay := range result.Relays {
+			mgmt.Neo.Execute(`MATCH(u:User), (r:Relay) WHERE u.pubkey=$pubkey and r.name=$name MERGE (u)-[:NIP05_RELAY]->(r);`, map[string]any{"pubkey": pubkey, "name": helper.CleanRelayName(relay)})
+		}
+	}
+}
+
+/*
+storeProfile stores the kind 0 metadata on the User node
+*/
+func (mgmt *Manager) storeProfile(profile *Profile) {
+	mgmt.Neo.Execute(`MERGE(u:User {pubkey: $pubkey}) SET u.name=$name, u.displayName=$displayName, u.about=$about, u.picture=$picture, u.lud16=$lud16, u.profileCreatedAt=$createdAt`, map[string]any{
+		"pubkey": profile.PubKey, "name": profile.Name, "displayName": profile.DisplayName, "about": profile.About,
+		"picture": profile.Picture, "lud16": profile.Lud16, "createdAt": profile.CreatedAt,
+	})
+}
+
+/*
+collectOperator remembers the relays owned by a pubkey for the operator enrichment
+*/
+func (mgmt *Manager) collectOperator(pubkey string, relay string) {
+	mgmt.usersMutex.Lock()
+	defer mgmt.usersMutex.Unlock()
+	if mgmt.operatorRelays == nil {
+		mgmt.operatorRelays = make(map[string][]string)
+	}
+	mgmt.operatorRelays[pubkey] = append(mgmt.operatorRelays[pubkey], relay)
+}
+
+/*
+enrichOperators fetches the kind 0 profile and kind 10002 relay list of every relay owner from the relays they own
+*/
+func (mgmt *Manager) enrichOperators() {
+	mgmt.logger().Info("enriching relay operators", "operators", len(mgmt.operatorRelays))
+	profiles := FetchProfiles(mgmt.operatorRelays)
+	relayLists := make(map[string]*nostr.Event)
+	byRelay := make(map[string][]string)
+	for pubkey, relays := range mgmt.operatorRelays {
+		for _, relay := range relays[:min(3, len(relays))] {
+			byRelay[relay] = append(byRelay[relay], pubkey)
+		}
+	}
+	for relay, pubkeys := range byRelay {
+		for pubkey, event := range FetchLatestEvents(relay, 10002, pubkeys) {
+			if current, ok := relayLists[pubkey]; !ok || event.CreatedAt > current.CreatedAt {
+				relayLists[pubkey] = event
+			}
+		}
+	}
+
+	for pubkey, relays := range mgmt.operatorRelays {
+		mgmt.Neo.Execute(`MATCH(u:User) WHERE u.pubkey=$pubkey SET u.operator=true, u.relaysOwned=$owned`, map[string]any{"pubkey": pubkey, "owned": len(relays)})
+		if profile, ok := profiles[pubkey]; ok {
+			mgmt.storeProfile(profile)
+		}
+		if event, ok := relayLists[pubkey]; ok {
+			_, used := helper.FindRelayForUser(event)
+			for _, relay := range used {
+				mgmt.Neo.Execute(`MATCH(r:Relay), (u:User) WHERE r.name=$name and u.pubkey=$pubkey MERGE (u)-[:USES]->(r);`, map[string]any{"pubkey": pubkey, "name": helper.CleanRelayName(relay)})
+			}
+		}
+	}
+}
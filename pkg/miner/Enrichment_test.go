@@ -0,0 +1,41 @@
+package miner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+TestWriteRelays tests the selection of the write relays from a kind 10002 event
+*/
+func TestWriteRelays(t *testing.T) {
+	event := &nostr.Event{
+		Kind: 10002,
+		Tags: nostr.Tags{
+			{"r", "wss://both.com/"},
+			{"r", "wss://write.com/", "write"},
+			{"r", "wss://read.com/", "read"},
+			{"p", "pubkey"},
+		},
+	}
+	want := []string{"wss://both.com/", "wss://write.com/"}
+	if got := WriteRelays(event); !reflect.DeepEqual(got, want) {
+		t.Errorf("WriteRelays() = %v, want %v", got, want)
+	}
+}
+
+/*
+TestParseProfile tests reading the metadata from a kind 0 event
+*/
+func TestParseProfile(t *testing.T) {
+	event := &nostr.Event{PubKey: "pubkey", CreatedAt: 10, Content: `{"name": "bob", "nip05": "bob@relay.com"}`}
+	profile, err := ParseProfile(event)
+	if err != nil || profile.Name != "bob" || profile.Nip05 != "bob@relay.com" || profile.PubKey != "pubkey" || profile.CreatedAt != 10 {
+		t.Errorf("ParseProfile() = %+v with %v", profile, err)
+	}
+	if _, err := ParseProfile(&nostr.Event{Content: "not json"}); err == nil {
+		t.Errorf("ParseProfile() expected an error for invalid content")
+	}
+}
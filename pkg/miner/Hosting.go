@@ -0,0 +1,152 @@
+package miner
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+/*
+Kinds of shared hosting a cluster is built from
+*/
+const (
+	ClusterSharedIP  = "ip"     // relays resolving to the same address
+	ClusterPrefix    = "prefix" // relays in the same /24 (IPv4) or /48 (IPv6) network
+	ClusterASN       = "asn"    // relays announced by the same autonomous system
+	ClusterPtrDomain = "ptr"    // relays whose addresses reverse resolve into the same domain
+)
+
+/*
+HostedRelay is an address of a relay with what is known about where it is hosted
+*/
+type HostedRelay struct {
+	Relay     string
+	Address   string
+	ASN       int64
+	PtrDomain string
+}
+
+/*
+HostingCluster is a group of relays sharing a piece of hosting infrastructure
+*/
+type HostingCluster struct {
+	Kind   string
+	Key    string
+	Relays []string
+}
+
+/*
+HostingPrefix returns the /24 network of IPv4 and the /48 network of IPv6 addresses
+*/
+func HostingPrefix(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+/*
+PtrDomain returns the registrable domain of a PTR name, e.g. your-server.de for static.4.3.2.1.clients.your-server.de
+only ICANN suffixes are considered, so names under private suffixes like compute.amazonaws.com still group by the provider
+*/
+func PtrDomain(ptr string) string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(ptr), "."), ".")
+	for i := 1; i < len(labels); i++ {
+		candidate := strings.Join(labels[i:], ".")
+		if suffix, icann := publicsuffix.PublicSuffix(candidate); icann && suffix == candidate {
+			return strings.Join(labels[i-1:], ".")
+		}
+	}
+	return ""
+}
+
+/*
+Clusters groups the relays by shared address, prefix, ASN and PTR domain, groups of a single relay are dropped
+*/
+func Clusters(hosts []HostedRelay) []*HostingCluster {
+	groups := make(map[[2]string][]string)
+	add := func(kind string, key string, relay string) {
+		if key == "" {
+			return
+		}
+		id := [2]string{kind, key}
+		if !slices.Contains(groups[id], relay) {
+			groups[id] = append(groups[id], relay)
+		}
+	}
+	for _, host := range hosts {
+		ip := net.ParseIP(host.Address)
+		if ip == nil {
+			continue
+		}
+		add(ClusterSharedIP, ip.String(), host.Relay)
+		add(ClusterPrefix, HostingPrefix(ip), host.Relay)
+		if host.ASN != 0 {
+			add(ClusterASN, fmt.Sprintf("AS%d", host.ASN), host.Relay)
+		}
+		add(ClusterPtrDomain, host.PtrDomain, host.Relay)
+	}
+
+	clusters := make([]*HostingCluster, 0)
+	for id, relays := range groups {
+		if len(relays) < 2 {
+			continue
+		}
+		slices.Sort(relays)
+		clusters = append(clusters, &HostingCluster{Kind: id[0], Key: id[1], Relays: relays})
+	}
+	slices.SortFunc(clusters, func(a, b *HostingCluster) int {
+		return strings.Compare(a.Kind+" "+a.Key, b.Kind+" "+b.Key)
+	})
+	return clusters
+}
+
+/*
+storeReverse stores the PTR names and the network prefix of the IP node
+*/
+func (rnr *Runner) storeReverse(ip net.IP) {
+	records, class := dnsResolver.Reverse(ip)
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		names = append(names, record.Value)
+	}
+	domain := ""
+	if len(names) > 0 {
+		domain = PtrDomain(names[0])
+	}
+	rnr.Neo.Execute(`MATCH(i:IP) WHERE i.address=$address SET i.ptr=$ptr, i.ptrDomain=$domain, i.ptrError=$error, i.prefix=$prefix`, map[string]any{
+		"address": ip.String(), "ptr": names, "domain": domain, "error": class, "prefix": HostingPrefix(ip),
+	})
+}
+
+/*
+clusterHosting groups the valid relays of the crawl into hosting clusters and stores them
+*/
+func (mgmt *Manager) clusterHosting() {
+	records, err := mgmt.Neo.Query(`MATCH (c:Crawl)<-[:SEEN_IN]-(r:Relay)-[:HAS_IP]->(i:IP) WHERE c.id=$crawl and r.isValid=true RETURN r.name AS relay, i.address AS address, i.asn AS asn, i.ptrDomain AS ptrDomain`, map[string]any{"crawl": mgmt.CrawlId})
+	if err != nil {
+		mgmt.logger().Error("loading the relay addresses for clustering failed", "error", err)
+		return
+	}
+	hosts := make([]HostedRelay, 0, len(records))
+	for _, record := range records {
+		host := HostedRelay{}
+		host.Relay, _ = record["relay"].(string)
+		host.Address, _ = record["address"].(string)
+		host.ASN, _ = record["asn"].(int64)
+		host.PtrDomain, _ = record["ptrDomain"].(string)
+		hosts = append(hosts, host)
+	}
+	clusters := Clusters(hosts)
+	mgmt.logger().Info("found hosting clusters", "clusters", len(clusters))
+	for _, cluster := range clusters {
+		params := map[string]any{"kind": cluster.Kind, "key": cluster.Key, "size": len(cluster.Relays), "crawl": mgmt.CrawlId}
+		mgmt.Neo.Execute(`MERGE(h:HostingCluster {kind: $kind, key: $key}) SET h.size=$size, h.crawl=$crawl`, params)
+		for _, relay := range cluster.Relays {
+			mgmt.Neo.Execute(`MATCH(r:Relay), (h:HostingCluster) WHERE r.name=$name and h.kind=$kind and h.key=$key MERGE (r)-[:HOSTED_IN]->(h);`, map[string]any{"name": relay, "kind": cluster.Kind, "key": cluster.Key})
+		}
+	}
+}
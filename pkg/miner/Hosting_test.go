@@ -0,0 +1,74 @@
+package miner
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+/*
+TestHostingPrefix tests the networks addresses are grouped in
+*/
+func TestHostingPrefix(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{address: "192.0.2.17", want: "192.0.2.0/24"},
+		{address: "2001:db8:1234:5678::1", want: "2001:db8:1234::/48"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := HostingPrefix(net.ParseIP(tt.address)); got != tt.want {
+				t.Errorf("HostingPrefix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestPtrDomain tests the registrable domain of PTR names
+*/
+func TestPtrDomain(t *testing.T) {
+	tests := []struct {
+		ptr  string
+		want string
+	}{
+		{ptr: "static.4.3.2.1.clients.your-server.de.", want: "your-server.de"},
+		{ptr: "ec2-1-2-3-4.eu-central-1.compute.amazonaws.com", want: "amazonaws.com"},
+		{ptr: "host.example.co.uk", want: "example.co.uk"},
+		{ptr: "localhost", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ptr, func(t *testing.T) {
+			if got := PtrDomain(tt.ptr); got != tt.want {
+				t.Errorf("PtrDomain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestClusters tests that relays sharing hosting infrastructure are grouped
+*/
+func TestClusters(t *testing.T) {
+	hosts := []HostedRelay{
+		{Relay: "a.example.com", Address: "192.0.2.1", ASN: 24940, PtrDomain: "your-server.de"},
+		{Relay: "b.example.com", Address: "192.0.2.1", ASN: 24940, PtrDomain: "your-server.de"},
+		{Relay: "c.example.org", Address: "192.0.2.200", ASN: 24940},
+		{Relay: "d.example.net", Address: "198.51.100.1", ASN: 13335},
+		{Relay: "d.example.net", Address: "198.51.100.2", ASN: 13335},
+	}
+	want := []*HostingCluster{
+		{Kind: ClusterASN, Key: "AS24940", Relays: []string{"a.example.com", "b.example.com", "c.example.org"}},
+		{Kind: ClusterSharedIP, Key: "192.0.2.1", Relays: []string{"a.example.com", "b.example.com"}},
+		{Kind: ClusterPrefix, Key: "192.0.2.0/24", Relays: []string{"a.example.com", "b.example.com", "c.example.org"}},
+		{Kind: ClusterPtrDomain, Key: "your-server.de", Relays: []string{"a.example.com", "b.example.com"}},
+	}
+	if got := Clusters(hosts); !reflect.DeepEqual(got, want) {
+		for _, cluster := range got {
+			t.Logf("%+v", cluster)
+		}
+		t.Errorf("Clusters() returned %d clusters, want %d", len(got), len(want))
+	}
+}
@@ -1,8 +1,14 @@
 package miner
 
 import (
+	"log/slog"
 	"sync"
+	"time"
 
+	"github.com/SEG-UNIBE/artio-miner/pkg/geoip"
+	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+	"github.com/SEG-UNIBE/artio-miner/pkg/logging"
+	"github.com/SEG-UNIBE/artio-miner/pkg/policy"
 	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
 )
 
@@ -11,15 +17,35 @@ Manager is the main object to handle the mining process
 holds the neo4j instance and the list of miners with some results for for handling recursion
 */
 type Manager struct {
-	Neo          *storage.Neo4jInstance
-	MaxRecursion int
-	miners       []*RelayMiner
-	loadMap      map[string]bool
-	mapMutex     sync.RWMutex
-	RelayQueue   *Queue
-	MaxRunners   int
-	runners      []*Runner
-	PushUsers    bool
+	Neo              *storage.Neo4jInstance
+	MaxRecursion     int
+	miners           []*RelayMiner
+	loadMap          map[string]bool
+	mapMutex         sync.RWMutex
+	RelayQueue       *Queue
+	MaxRunners       int
+	runners          []*Runner
+	PushUsers        bool
+	AuthKey          string
+	ProbeNips        bool
+	Census           bool
+	Publisher        *Publisher // publishes NIP-66 events for the mined relays if set
+	Nip66Sources     []string   // relays queried for NIP-66 events of other monitors to seed the crawl
+	Nip66Limit       int
+	reports          []*MonitorReport
+	monitors         []*MonitorAnnouncement
+	CrawlId          string // identifies the measurements of this run, generated from the start time if empty
+	EnrichUsers      bool   // fetch the profiles of the found users and resolve their NIP-05 identifiers after the crawl
+	MaxEnrichedUsers int
+	userRelays       map[string][]string
+	usersMutex       sync.Mutex
+	EnrichOperators  bool // fetch the profile and relay list of the relay owners after the crawl
+	operatorRelays   map[string][]string
+	GeoIP            *geoip.Databases // attaches location and ASN to the IP addresses if set
+	RateLimit        float64          // relays started per second over all runners, zero is unlimited
+	rateTicker       *time.Ticker
+	Policy           *policy.Policy // relays excluded by the policy are recorded but not crawled
+	progress         crawlProgress
 }
 
 /*
@@ -31,23 +57,58 @@ func (mgmt *Manager) Run(relays []string) {
 	mgmt.loadMap = make(map[string]bool)
 	mgmt.mapMutex = sync.RWMutex{}
 	mgmt.RelayQueue = new(Queue)
+	if mgmt.CrawlId == "" {
+		mgmt.CrawlId = NewCrawlId(time.Now())
+	}
+	mgmt.progress.start(mgmt.CrawlId, mgmt.RelayQueue, mgmt.MaxRunners)
+	defer mgmt.progress.stop()
+	mgmt.Neo.Execute(`MERGE(c:Crawl {id: $crawl}) SET c.startedAt=$startedAt`, map[string]any{"crawl": mgmt.CrawlId, "startedAt": time.Now().Unix()})
 
 	// push all NIPs
 	for i := range 100 {
 		mgmt.Neo.Execute(`MERGE(n:NIP {name: $nip})`, map[string]any{"nip": i})
 	}
 
+	if mgmt.Publisher != nil {
+		if err := mgmt.Publisher.Announce(); err != nil {
+			mgmt.logger().Warn("publishing the monitor announcement failed", "error", err)
+		}
+	}
+
+	if len(mgmt.Nip66Sources) > 0 {
+		var err error
+		mgmt.reports, mgmt.monitors, err = DiscoverRelays(mgmt.Nip66Sources, mgmt.Nip66Limit)
+		if err != nil {
+			mgmt.logger().Warn("NIP-66 discovery failed", "error", err)
+		}
+		mgmt.logger().Info("found NIP-66 relay reports", "reports", len(mgmt.reports), "monitors", len(mgmt.monitors))
+		for _, report := range mgmt.reports {
+			relays = append(relays, report.Relay)
+		}
+	}
+
 	for _, relay := range relays {
-		newMiner := NewMiner(relay)
+		newMiner := mgmt.NewMiner(relay)
 		newMiner.RecursionLevel = mgmt.MaxRecursion
 		mgmt.miners = append(mgmt.miners, newMiner)
 	}
 
 	for _, relay := range mgmt.miners {
+		if _, seeded := mgmt.loadMap[relay.CleanName()]; seeded {
+			continue
+		}
 		mgmt.loadMap[relay.CleanName()] = false
+		if mgmt.excluded(relay) {
+			continue
+		}
 		mgmt.RelayQueue.Enqueue(relay)
 	}
 
+	if mgmt.RateLimit > 0 {
+		mgmt.rateTicker = time.NewTicker(time.Duration(float64(time.Second) / mgmt.RateLimit))
+		defer mgmt.rateTicker.Stop()
+	}
+
 	for i := range mgmt.MaxRunners {
 		runner := Runner{Manager: mgmt, Id: i}
 		mgmt.runners = append(mgmt.runners, &runner)
@@ -58,6 +119,70 @@ func (mgmt *Manager) Run(relays []string) {
 		// wait until all runners are done
 	}
 	mgmt.StopAll()
+	mgmt.storeMonitorReports()
+	mgmt.clusterHosting()
+	if mgmt.EnrichUsers {
+		mgmt.enrichUsers()
+	}
+	if mgmt.EnrichOperators {
+		mgmt.enrichOperators()
+	}
+	mgmt.Neo.Execute(`MATCH(c:Crawl) WHERE c.id=$crawl SET c.finishedAt=$finishedAt`, map[string]any{"crawl": mgmt.CrawlId, "finishedAt": time.Now().Unix()})
+	status := mgmt.Status()
+	logging.Summary(mgmt.logger(), "crawl finished", "visited", status.Visited, "valid", status.Valid, "invalid", status.Invalid,
+		"reasons", status.Reasons, "duration", time.Since(status.StartedAt).Round(time.Second))
+}
+
+/*
+logger returns the default logger with the crawl attached
+*/
+func (mgmt *Manager) logger() *slog.Logger {
+	return slog.Default().With("crawl", mgmt.CrawlId)
+}
+
+/*
+NewCrawlId creates the id of a crawl started at the given time
+*/
+func NewCrawlId(start time.Time) string {
+	return start.UTC().Format("20060102T150405Z")
+}
+
+/*
+storeMonitorReports stores which NIP-66 monitor reported which relay with the reported attributes
+*/
+func (mgmt *Manager) storeMonitorReports() {
+	for _, monitor := range mgmt.monitors {
+		mgmt.Neo.Execute(`MERGE(m:Monitor {pubkey: $pubkey}) SET m.frequency=$frequency, m.checks=$checks`, map[string]any{"pubkey": monitor.Monitor, "frequency": monitor.Frequency, "checks": monitor.Checks})
+	}
+	for _, report := range mgmt.reports {
+		mgmt.Neo.Execute(`MERGE(m:Monitor {pubkey: $pubkey})`, map[string]any{"pubkey": report.Monitor})
+		mgmt.Neo.Execute(`MATCH(m:Monitor), (r:Relay) WHERE m.pubkey=$pubkey and r.name=$name MERGE (m)-[rep:REPORTED]->(r) SET rep.createdAt=$createdAt, rep.network=$network, rep.nips=$nips, rep.requirements=$requirements, rep.topics=$topics, rep.rttOpen=$rttOpen, rep.rttRead=$rttRead, rep.rttWrite=$rttWrite;`, map[string]any{
+			"pubkey": report.Monitor, "name": helper.CleanRelayName(report.Relay), "createdAt": int64(report.CreatedAt), "network": report.Network,
+			"nips": report.Nips, "requirements": report.Requirements, "topics": report.Topics,
+			"rttOpen": report.RttOpen, "rttRead": report.RttRead, "rttWrite": report.RttWrite,
+		})
+	}
+}
+
+/*
+NewMiner creates a RelayMiner carrying the settings of the manager
+*/
+func (mgmt *Manager) NewMiner(relayUrl string) *RelayMiner {
+	rm := NewMiner(relayUrl)
+	rm.AuthKey = mgmt.AuthKey
+	rm.ProbeNips = mgmt.ProbeNips
+	rm.Census = mgmt.Census
+	rm.Policy = mgmt.Policy
+	return rm
+}
+
+/*
+throttle waits until the rate limit allows to start the next relay
+*/
+func (mgmt *Manager) throttle() {
+	if mgmt.rateTicker != nil {
+		<-mgmt.rateTicker.C
+	}
 }
 
 func (mgmt *Manager) StartAll() {
@@ -82,9 +207,66 @@ func (mgmt *Manager) Enqueue(rm *RelayMiner) {
 		return
 	}
 	mgmt.SetLoadMapEntryTrue(rm.CleanName())
+	if mgmt.excluded(rm) {
+		return
+	}
 	mgmt.RelayQueue.Enqueue(rm)
 }
 
+/*
+excluded checks the relay against the policy and records the rule on the relay if it is excluded
+*/
+func (mgmt *Manager) excluded(rm *RelayMiner) bool {
+	if mgmt.Policy == nil {
+		return false
+	}
+	if rm.ExcludedBy == "" && !rm.exclude(nil) {
+		return false
+	}
+	mgmt.storeExclusion(rm)
+	return true
+}
+
+/*
+storeExclusion records an excluded relay with the rule that excluded it and its failed validation
+*/
+func (mgmt *Manager) storeExclusion(rm *RelayMiner) {
+	params := map[string]any{"name": rm.CleanName(), "validReason": rm.InvalidReason, "rule": rm.ExcludedBy, "crawl": mgmt.CrawlId}
+	mgmt.Neo.Execute(`MERGE(r:Relay {name: $name, isValid: false, validReason: $validReason}) SET r.excludedBy=$rule`, params)
+	mgmt.Neo.Execute(`MATCH(r:Relay), (c:Crawl) WHERE r.name=$name and r.validReason=$validReason and c.id=$crawl MERGE (r)-[:SEEN_IN]->(c);`, params)
+	if rm.DetectedBy != nil {
+		mgmt.Neo.Execute(`MATCH(r1:Relay), (r2:Relay) WHERE r1.name=$name1 and r2.name=$name2 and r2.validReason=$validReason MERGE (r1)-[:DETECTED]->(r2);`, map[string]any{"name1": rm.DetectedBy.CleanName(), "name2": rm.CleanName(), "validReason": rm.InvalidReason})
+	}
+	if rm.Probe == nil {
+		// excluded when enqueued, the relay is never loaded
+		rm.excludedProbe()
+	}
+	mgmt.storeProbe(rm)
+}
+
+/*
+storeProbe stores the error of the relay and every stage of the probe as ProbeStage node of the current crawl
+*/
+func (mgmt *Manager) storeProbe(relay *RelayMiner) {
+	probe := relay.Probe
+	if probe == nil {
+		return
+	}
+	mgmt.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.errorClass=$errorClass, r.error=$error, r.probeMs=$durationMs`,
+		map[string]any{"name": relay.CleanName(), "errorClass": probe.ErrorClass, "error": probe.Error, "durationMs": probe.DurationMs})
+	for position, stage := range probe.Stages {
+		params := map[string]any{
+			"name": relay.CleanName(), "crawl": mgmt.CrawlId, "stage": stage.Stage, "position": position, "status": stage.Status,
+			"errorClass": stage.ErrorClass, "error": stage.Error, "reason": stage.Reason, "durationMs": stage.DurationMs,
+		}
+		mgmt.Neo.Execute(`MATCH(r:Relay), (c:Crawl) WHERE r.name=$name and c.id=$crawl
+			MERGE (p:ProbeStage {relay: $name, crawl: $crawl, stage: $stage})
+			SET p.position=$position, p.status=$status, p.errorClass=$errorClass, p.error=$error, p.reason=$reason, p.durationMs=$durationMs
+			MERGE (r)-[:PROBED]->(p)
+			MERGE (p)-[:IN_CRAWL]->(c);`, params)
+	}
+}
+
 /*
 AnyRunnerActive checks if any of the provided runners is currently active
 */
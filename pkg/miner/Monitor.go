@@ -0,0 +1,249 @@
+package miner
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/logging"
+	"github.com/SEG-UNIBE/artio-miner/pkg/policy"
+	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
+)
+
+/*
+uptimeWindows are the windows the uptime of a relay is computed over, keyed by the property suffix
+*/
+var uptimeWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+/*
+Monitor re-probes every known relay on a schedule and records the reachability history
+*/
+type Monitor struct {
+	Neo         *storage.Neo4jInstance
+	Interval    time.Duration // time between the start of two cycles
+	Jitter      time.Duration // maximum random delay before a single relay is checked
+	Concurrency int
+	Publisher   *Publisher     // publishes NIP-66 events for the reachable relays if set
+	Policy      *policy.Policy // relays excluded by the policy are not checked
+}
+
+/*
+Check holds the result of a single monitoring probe of a relay
+*/
+type Check struct {
+	Relay     string
+	Time      time.Time
+	Reachable bool
+	Error     string
+	Nip11     *Nip11Validation
+	Software  string
+	Version   string
+	Timings   *Timings // websocket open
+	Nip11Time *Timings
+}
+
+/*
+CheckPoint is a single reachability observation used to compute the uptime
+*/
+type CheckPoint struct {
+	Time      time.Time
+	Reachable bool
+}
+
+/*
+Run checks all known relays every interval until the context is cancelled
+*/
+func (mon *Monitor) Run(ctx context.Context) {
+	if mon.Publisher != nil {
+		if err := mon.Publisher.Announce(); err != nil {
+			slog.Warn("publishing the monitor announcement failed", "error", err)
+		}
+	}
+	for {
+		start := time.Now()
+		mon.Cycle(ctx)
+		logging.Summary(slog.Default(), "monitor cycle finished", "duration", time.Since(start))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(start.Add(mon.Interval))):
+		}
+	}
+}
+
+/*
+Cycle checks every known relay once, with at most Concurrency checks in parallel
+*/
+func (mon *Monitor) Cycle(ctx context.Context) {
+	relays, err := mon.KnownRelays()
+	if err != nil {
+		slog.Error("loading the known relays failed", "error", err)
+		return
+	}
+	slog.Info("monitor checking relays", "relays", len(relays))
+	concurrency := max(mon.Concurrency, 1)
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, relay := range relays {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case slots <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(relay string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if mon.Jitter > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Duration(rand.Int63n(int64(mon.Jitter)))):
+				}
+			}
+			if check := mon.Check(relay); check != nil {
+				mon.store(check)
+			}
+		}(relay)
+	}
+	wg.Wait()
+}
+
+/*
+KnownRelays loads the address of every relay in the database, relays without a known address are checked as wss
+relays excluded by a crawl or by the policy of the monitor are left out
+*/
+func (mon *Monitor) KnownRelays() ([]string, error) {
+	records, err := mon.Neo.Query(`MATCH (r:Relay) WHERE r.excludedBy IS NULL
+		OPTIONAL MATCH (r)-[:ALT_NAME]->(ra:RelayAlternativeName)
+		RETURN r.name AS name, head(collect(ra.name)) AS address`, map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	relays := make([]string, 0, len(records))
+	for _, record := range records {
+		name, _ := record["name"].(string)
+		address, _ := record["address"].(string)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if address == "" {
+			address = "wss://" + name
+		}
+		if rule := mon.Policy.Excluded(address, nil); rule != "" {
+			slog.Debug("relay is excluded", "relay", address, "rule", rule)
+			continue
+		}
+		relays = append(relays, address)
+	}
+	return relays, nil
+}
+
+/*
+Check probes a single relay for reachability, NIP-11 and latency
+nil is returned if the policy excludes the relay once it is resolved
+*/
+func (mon *Monitor) Check(relay string) *Check {
+	check := &Check{Relay: relay, Time: time.Now()}
+	rm := NewMiner(relay)
+	rm.Policy = mon.Policy
+	rm.Validate()
+	if rm.ExcludedBy != "" {
+		return nil
+	}
+	if !rm.IsValid {
+		check.Error = rm.InvalidReason
+		return check
+	}
+	rm.LoadNIP11()
+	check.Nip11 = rm.Nip11Validation
+	check.Nip11Time = rm.Nip11Timings
+	if rm.Nip11Document != nil {
+		check.Software = rm.Software()
+		check.Version = rm.SoftwareVersion()
+	}
+
+	check.Timings = NewTimings()
+	c, err := dialWebsocket(relay, check.Timings)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	_ = c.Close()
+	check.Reachable = true
+	if mon.Publisher != nil {
+		if err := mon.Publisher.PublishRelay(rm); err != nil {
+			slog.Warn("publishing the NIP-66 event failed", "relay", relay, "error", err)
+		}
+	}
+	return check
+}
+
+/*
+store saves the check as part of the relay history and updates the uptime of the relay
+*/
+func (mon *Monitor) store(check *Check) {
+	name := NewMiner(check.Relay).CleanName()
+	params := map[string]any{
+		"name": name, "time": check.Time.Unix(), "reachable": check.Reachable, "error": check.Error,
+		"software": check.Software, "version": check.Version, "nip11Class": nil, "openMs": float64(-1), "nip11FirstByteMs": float64(-1),
+	}
+	if check.Nip11 != nil {
+		params["nip11Class"] = check.Nip11.Class
+	}
+	if check.Timings != nil {
+		params["openMs"] = check.Timings.Milliseconds()["upgradeMs"]
+	}
+	if check.Nip11Time != nil {
+		params["nip11FirstByteMs"] = check.Nip11Time.Milliseconds()["firstByteMs"]
+	}
+	// a relay whose validity changed has several nodes, the check is attached to one of them, the valid one if any
+	mon.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name WITH r ORDER BY r.isValid DESC LIMIT 1
+		CREATE (r)-[:HAS_CHECK]->(c:Check {relay: $name, time: $time, reachable: $reachable, error: $error, software: $software, version: $version, nip11Class: $nip11Class, openMs: $openMs, nip11FirstByteMs: $nip11FirstByteMs})`, params)
+
+	records, err := mon.Neo.Query(`MATCH (c:Check) WHERE c.relay=$name and c.time >= $since RETURN c.time AS time, c.reachable AS reachable`, map[string]any{"name": name, "since": check.Time.Add(-uptimeWindows["30d"]).Unix()})
+	if err != nil {
+		slog.Error("loading the checks failed", "relay", name, "error", err)
+		return
+	}
+	points := make([]CheckPoint, 0, len(records))
+	for _, record := range records {
+		seconds, _ := record["time"].(int64)
+		reachable, _ := record["reachable"].(bool)
+		points = append(points, CheckPoint{Time: time.Unix(seconds, 0), Reachable: reachable})
+	}
+	uptime := map[string]any{"name": name, "lastCheck": check.Time.Unix(), "reachable": check.Reachable}
+	for suffix, window := range uptimeWindows {
+		uptime["uptime"+suffix] = Uptime(points, check.Time, window)
+	}
+	mon.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.uptime24h=$uptime24h, r.uptime7d=$uptime7d, r.uptime30d=$uptime30d, r.lastCheck=$lastCheck, r.reachable=$reachable`, uptime)
+}
+
+/*
+Uptime returns the share of reachable checks within the window before now, or -1 without checks in the window
+*/
+func Uptime(points []CheckPoint, now time.Time, window time.Duration) float64 {
+	total, reachable := 0, 0
+	for _, point := range points {
+		if point.Time.Before(now.Add(-window)) || point.Time.After(now) {
+			continue
+		}
+		total++
+		if point.Reachable {
+			reachable++
+		}
+	}
+	if total == 0 {
+		return -1
+	}
+	return float64(reachable) / float64(total)
+}
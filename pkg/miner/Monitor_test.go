@@ -0,0 +1,65 @@
+package miner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/policy"
+)
+
+/*
+TestUptime tests the uptime computation over the different windows
+*/
+func TestUptime(t *testing.T) {
+	now := time.Now()
+	points := []CheckPoint{
+		{Time: now.Add(-1 * time.Hour), Reachable: true},
+		{Time: now.Add(-2 * time.Hour), Reachable: false},
+		{Time: now.Add(-3 * 24 * time.Hour), Reachable: true},
+		{Time: now.Add(-3 * 24 * time.Hour), Reachable: true},
+		{Time: now.Add(-20 * 24 * time.Hour), Reachable: false},
+	}
+	tests := []struct {
+		name   string
+		window time.Duration
+		want   float64
+	}{
+		{name: "Uptime_24h", window: uptimeWindows["24h"], want: 0.5},
+		{name: "Uptime_7d", window: uptimeWindows["7d"], want: 0.75},
+		{name: "Uptime_30d", window: uptimeWindows["30d"], want: 0.6},
+		{name: "Uptime_Empty", window: time.Minute, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Uptime(points, now, tt.window); got != tt.want {
+				t.Errorf("Uptime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestMonitorCheck_Policy tests that relays excluded by the policy of the monitor are not checked
+*/
+func TestMonitorCheck_Policy(t *testing.T) {
+	rules, err := policy.New(nil, []string{"*.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon := &Monitor{Policy: rules}
+	tests := []struct {
+		name    string
+		relay   string
+		checked bool
+	}{
+		{name: "Check_Excluded", relay: "wss://relay.example.com", checked: false},
+		{name: "Check_Allowed", relay: "wss://relay.invalid", checked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if check := mon.Check(tt.relay); (check != nil) != tt.checked {
+				t.Errorf("Check() = %+v, checked %v", check, tt.checked)
+			}
+		})
+	}
+}
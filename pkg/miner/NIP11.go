@@ -1,40 +1,250 @@
 package miner
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"mime"
 	"net/http"
+	"slices"
 	"time"
+
+	"github.com/nbd-wtf/go-nostr"
 )
 
+/*
+NIP-11 fetch classes, describing how far a relay got towards a compliant information document
+*/
+const (
+	Nip11ClassOk           = "ok"
+	Nip11ClassUnreachable  = "unreachable"
+	Nip11ClassHttpError    = "http_error"
+	Nip11ClassHtml         = "html"
+	Nip11ClassInvalidJson  = "invalid_json"
+	Nip11ClassNonCompliant = "non_compliant"
+)
+
+/*
+Nip11Response holds the body and the relevant headers of a NIP-11 request
+*/
+type Nip11Response struct {
+	Body         []byte
+	StatusCode   int
+	ContentType  string
+	AllowOrigin  string
+	AllowHeaders string
+	AllowMethods string
+	Timings      *Timings
+}
+
+/*
+Nip11Validation holds the classification of a NIP-11 fetch
+*/
+type Nip11Validation struct {
+	Class            string
+	HttpStatus       int
+	ContentType      string
+	ContentTypeValid bool
+	Cors             bool
+	JsonValid        bool
+	Violations       []string
+}
+
+/*
+Compliant returns true if the document was served and formed as NIP-11 demands
+*/
+func (v *Nip11Validation) Compliant() bool {
+	return v.Class == Nip11ClassOk
+}
+
 /*
 GetNip11 fetches the NIP 11 Information for a specifc relay
 */
-func GetNip11(relay string) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func GetNip11(relay string) (*Nip11Response, error) {
+	timings := NewTimings()
+	timeout := nip11Timeout
+	client := &http.Client{Timeout: 3 * timeout}
+	if proxy := proxyFor(relay); proxy != nil {
+		// hidden services are slow to build a circuit to
+		timeout = 30 * time.Second
+		client = &http.Client{Timeout: timeout, Transport: &http.Transport{Proxy: proxy}}
+	}
+	ctx, cancel := context.WithTimeout(timings.WithTrace(context.Background()), timeout)
 	defer cancel()
-	client := &http.Client{Timeout: 3 * time.Second}
 	method := "GET"
 
 	req, err := http.NewRequestWithContext(ctx, method, relay, nil)
 	if err != nil {
-		log.Printf("Relay %s returned error: %s", relay, err)
 		return nil, err
 	}
 	req.Header.Add("Accept", "application/nostr+json")
 	// req.Header.Add("User-Agent", "relay-miner")
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Relay %s returned error: %s", relay, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Relay %s returned error: %s", relay, err)
 		return nil, err
 	}
-	return body, nil
+	return &Nip11Response{
+		Body:         body,
+		StatusCode:   resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		AllowOrigin:  resp.Header.Get("Access-Control-Allow-Origin"),
+		AllowHeaders: resp.Header.Get("Access-Control-Allow-Headers"),
+		AllowMethods: resp.Header.Get("Access-Control-Allow-Methods"),
+		Timings:      timings,
+	}, nil
+}
+
+/*
+ValidateNip11 classifies a NIP-11 response, a nil response means the relay did not answer at all
+*/
+func ValidateNip11(resp *Nip11Response) *Nip11Validation {
+	if resp == nil {
+		return &Nip11Validation{Class: Nip11ClassUnreachable}
+	}
+	validation := &Nip11Validation{HttpStatus: resp.StatusCode, ContentType: resp.ContentType, Violations: make([]string, 0)}
+	mediaType, _, _ := mime.ParseMediaType(resp.ContentType)
+	validation.ContentTypeValid = mediaType == "application/nostr+json"
+	validation.Cors = resp.AllowOrigin != ""
+	validation.Violations = ValidateNip11Document(resp.Body)
+	validation.JsonValid = json.Valid(resp.Body)
+
+	if !validation.ContentTypeValid {
+		validation.Violations = append(validation.Violations, fmt.Sprintf("content type is %q instead of application/nostr+json", resp.ContentType))
+	}
+	if resp.AllowOrigin == "" {
+		validation.Violations = append(validation.Violations, "missing Access-Control-Allow-Origin header")
+	}
+
+	trimmed := bytes.TrimSpace(resp.Body)
+	switch {
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		validation.Class = Nip11ClassHttpError
+	case mediaType == "text/html" || bytes.HasPrefix(trimmed, []byte("<")):
+		validation.Class = Nip11ClassHtml
+	case !validation.JsonValid:
+		validation.Class = Nip11ClassInvalidJson
+	case len(validation.Violations) > 0:
+		validation.Class = Nip11ClassNonCompliant
+	default:
+		validation.Class = Nip11ClassOk
+	}
+	return validation
+}
+
+/*
+nip11FieldTypes holds the JSON type of every field defined by NIP-11
+*/
+var nip11FieldTypes = map[string]string{
+	"name":             "string",
+	"description":      "string",
+	"banner":           "string",
+	"icon":             "string",
+	"pubkey":           "string",
+	"self":             "string",
+	"contact":          "string",
+	"software":         "string",
+	"version":          "string",
+	"privacy_policy":   "string",
+	"terms_of_service": "string",
+	"posting_policy":   "string",
+	"payments_url":     "string",
+	"supported_nips":   "array",
+	"relay_countries":  "array",
+	"language_tags":    "array",
+	"tags":             "array",
+	"retention":        "array",
+	"limitation":       "object",
+	"fees":             "object",
+}
+
+/*
+ValidateNip11Document checks a NIP-11 body against the schema and returns the found violations
+*/
+func ValidateNip11Document(body []byte) []string {
+	violations := make([]string, 0)
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(body, &document); err != nil {
+		if json.Valid(body) {
+			return append(violations, "document is not a JSON object")
+		}
+		return append(violations, "document is not valid JSON")
+	}
+	for field, value := range document {
+		expected, known := nip11FieldTypes[field]
+		if !known {
+			violations = append(violations, fmt.Sprintf("unknown field %q", field))
+			continue
+		}
+		if actual := jsonType(value); actual != expected && actual != "null" {
+			violations = append(violations, fmt.Sprintf("field %q is %v instead of %v", field, actual, expected))
+		}
+	}
+
+	var nips []json.RawMessage
+	if err := json.Unmarshal(document["supported_nips"], &nips); err == nil {
+		for _, nip := range nips {
+			if actual := jsonType(nip); actual != "number" {
+				violations = append(violations, fmt.Sprintf("supported_nips contains %v %v instead of a number", actual, string(nip)))
+			}
+		}
+	}
+	for _, field := range []string{"relay_countries", "language_tags", "tags"} {
+		var values []json.RawMessage
+		if err := json.Unmarshal(document[field], &values); err == nil {
+			for _, value := range values {
+				if actual := jsonType(value); actual != "string" {
+					violations = append(violations, fmt.Sprintf("%v contains %v %v instead of a string", field, actual, string(value)))
+				}
+			}
+		}
+	}
+	var limitation map[string]json.RawMessage
+	if err := json.Unmarshal(document["limitation"], &limitation); err == nil {
+		for field, value := range limitation {
+			expected := "number"
+			if field == "auth_required" || field == "payment_required" || field == "restricted_writes" {
+				expected = "boolean"
+			}
+			if actual := jsonType(value); actual != expected {
+				violations = append(violations, fmt.Sprintf("limitation %q is %v instead of %v", field, actual, expected))
+			}
+		}
+	}
+	var pubKey string
+	if err := json.Unmarshal(document["pubkey"], &pubKey); err == nil && pubKey != "" && !nostr.IsValid32ByteHex(pubKey) {
+		violations = append(violations, "pubkey is not 64 character hex")
+	}
+	slices.Sort(violations)
+	return violations
+}
+
+/*
+jsonType returns the JSON type name of a raw value
+*/
+func jsonType(value json.RawMessage) string {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 {
+		return "missing"
+	}
+	switch trimmed[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
 }
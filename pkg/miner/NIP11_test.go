@@ -0,0 +1,59 @@
+package miner
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+TestValidateNip11Document tests the ValidateNip11Document function and its output
+*/
+func TestValidateNip11Document(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "ValidateNip11Document_Valid", body: `{"name": "relay", "supported_nips": [1, 11], "limitation": {"max_limit": 500, "auth_required": false}}`, want: []string{}},
+		{name: "ValidateNip11Document_StringNip", body: `{"supported_nips": [1, "11"]}`, want: []string{`supported_nips contains string "11" instead of a number`}},
+		{name: "ValidateNip11Document_UnknownField", body: `{"name": "relay", "motd": "hello"}`, want: []string{`unknown field "motd"`}},
+		{name: "ValidateNip11Document_WrongType", body: `{"name": 5, "limitation": {"auth_required": "no"}}`, want: []string{`field "name" is number instead of string`, `limitation "auth_required" is string instead of boolean`}},
+		{name: "ValidateNip11Document_Pubkey", body: `{"pubkey": "npub1abc"}`, want: []string{"pubkey is not 64 character hex"}},
+		{name: "ValidateNip11Document_Html", body: `<html></html>`, want: []string{"document is not valid JSON"}},
+		{name: "ValidateNip11Document_Array", body: `[1, 2]`, want: []string{"document is not a JSON object"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateNip11Document([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateNip11Document() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestValidateNip11 tests the classification of NIP-11 responses
+*/
+func TestValidateNip11(t *testing.T) {
+	valid := `{"name": "relay", "supported_nips": [1, 11]}`
+	tests := []struct {
+		name string
+		resp *Nip11Response
+		want string
+	}{
+		{name: "ValidateNip11_Unreachable", resp: nil, want: Nip11ClassUnreachable},
+		{name: "ValidateNip11_Ok", resp: &Nip11Response{Body: []byte(valid), StatusCode: 200, ContentType: "application/nostr+json; charset=utf-8", AllowOrigin: "*"}, want: Nip11ClassOk},
+		{name: "ValidateNip11_NoCors", resp: &Nip11Response{Body: []byte(valid), StatusCode: 200, ContentType: "application/nostr+json"}, want: Nip11ClassNonCompliant},
+		{name: "ValidateNip11_ContentType", resp: &Nip11Response{Body: []byte(valid), StatusCode: 200, ContentType: "application/json", AllowOrigin: "*"}, want: Nip11ClassNonCompliant},
+		{name: "ValidateNip11_Html", resp: &Nip11Response{Body: []byte("<!DOCTYPE html>"), StatusCode: 200, ContentType: "text/html"}, want: Nip11ClassHtml},
+		{name: "ValidateNip11_HttpError", resp: &Nip11Response{Body: []byte("not found"), StatusCode: 404, ContentType: "text/plain"}, want: Nip11ClassHttpError},
+		{name: "ValidateNip11_InvalidJson", resp: &Nip11Response{Body: []byte(`{"name": `), StatusCode: 200, ContentType: "application/nostr+json", AllowOrigin: "*"}, want: Nip11ClassInvalidJson},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateNip11(tt.resp); got.Class != tt.want {
+				t.Errorf("ValidateNip11() = %v, want %v", got.Class, tt.want)
+			}
+		})
+	}
+}
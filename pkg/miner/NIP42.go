@@ -0,0 +1,40 @@
+package miner
+
+import (
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip42"
+)
+
+/*
+Authentication states recorded for a relay during the NIP-42 handshake
+*/
+const (
+	AuthStatusNone     = "none"     // the relay never asked for authentication
+	AuthStatusRequired = "required" // the relay asked for authentication, but no key was configured
+	AuthStatusAccepted = "accepted" // the relay accepted our signed challenge response
+	AuthStatusRejected = "rejected" // the relay rejected our signed challenge response
+)
+
+/*
+SignAuthEvent creates and signs the NIP-42 challenge response for the given relay with the secret key
+*/
+func SignAuthEvent(challenge string, relay string, secretKey string) (*nostr.Event, error) {
+	pubKey, err := nostr.GetPublicKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	event := nip42.CreateUnsignedAuthEvent(challenge, pubKey, relay)
+	if err := event.Sign(secretKey); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+/*
+IsAuthRequiredMessage checks if a CLOSED or OK message was sent because the relay requires authentication
+*/
+func IsAuthRequiredMessage(message string) bool {
+	return strings.HasPrefix(message, "auth-required:")
+}
@@ -0,0 +1,97 @@
+package miner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip42"
+)
+
+/*
+authRelay is a relay demanding NIP-42 authentication before it answers a REQ
+*/
+func authRelay(t *testing.T, accept bool, relayList *nostr.Event) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		url := "ws://" + r.Host
+		_ = c.WriteJSON([]any{"AUTH", "challenge"})
+		authenticated := false
+		for {
+			var message []json.RawMessage
+			if err := c.ReadJSON(&message); err != nil || len(message) < 2 {
+				return
+			}
+			var messageType, subscription string
+			_ = json.Unmarshal(message[0], &messageType)
+			switch messageType {
+			case "AUTH":
+				var event nostr.Event
+				_ = json.Unmarshal(message[1], &event)
+				if _, ok := nip42.ValidateAuthEvent(&event, "challenge", url); !ok {
+					t.Errorf("relay received an invalid AUTH event %v", event)
+				}
+				authenticated = accept
+				_ = c.WriteJSON([]any{"OK", event.ID, accept, ""})
+			case "REQ":
+				_ = json.Unmarshal(message[1], &subscription)
+				if !authenticated {
+					_ = c.WriteJSON([]any{"CLOSED", subscription, "auth-required: sign in first"})
+					continue
+				}
+				if subscription != "2" {
+					t.Errorf("REQ after authentication on subscription %q, want 2", subscription)
+				}
+				_ = c.WriteJSON([]any{"EVENT", subscription, relayList})
+				_ = c.WriteJSON([]any{"EOSE", subscription})
+			}
+		}
+	}))
+}
+
+/*
+TestGetRelayList_Auth tests the NIP-42 handshake of the relay list request
+*/
+func TestGetRelayList_Auth(t *testing.T) {
+	secretKey := nostr.GeneratePrivateKey()
+	relayList := &nostr.Event{Kind: 10002, Tags: nostr.Tags{{"r", "wss://relay.example.com"}}, CreatedAt: nostr.Now()}
+	if err := relayList.Sign(secretKey); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		accept     bool
+		authKey    string
+		wantStatus string
+		wantEvents int
+	}{
+		{name: "Auth_Accepted", accept: true, authKey: secretKey, wantStatus: AuthStatusAccepted, wantEvents: 1},
+		{name: "Auth_Rejected", accept: false, authKey: secretKey, wantStatus: AuthStatusRejected, wantEvents: 0},
+		{name: "Auth_NoKey", accept: true, authKey: "", wantStatus: AuthStatusRequired, wantEvents: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := authRelay(t, tt.accept, relayList)
+			defer server.Close()
+			result, err := GetRelayList("ws://"+strings.TrimPrefix(server.URL, "http://"), tt.authKey, nil)
+			if err != nil {
+				t.Fatalf("GetRelayList() error = %v", err)
+			}
+			if result.AuthStatus != tt.wantStatus || len(result.Events) != tt.wantEvents {
+				t.Errorf("GetRelayList() = %v with %d events, want %v with %d", result.AuthStatus, len(result.Events), tt.wantStatus, tt.wantEvents)
+			}
+			if tt.wantStatus == AuthStatusRequired && !strings.HasPrefix(result.Closed, "auth-required:") {
+				t.Errorf("GetRelayList() closed = %q, want the auth-required reason", result.Closed)
+			}
+		})
+	}
+}
@@ -2,10 +2,11 @@ package miner
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"slices"
+	"sync"
 	"syscall"
 	"time"
 
@@ -13,94 +14,229 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 )
 
+/*
+RelayListResult holds the events of Type 10002 of a relay together with how the request went
+*/
+type RelayListResult struct {
+	Events     []*nostr.Event
+	AuthStatus string
+	Timings    *Timings
+	Closed     string // reason of the relay for closing the subscription instead of sending EOSE
+	Notice     string // NOTICE that ended the request
+	ReadError  error  // the connection failed before the request ended
+	TimedOut   bool   // the request did not end within the relayListTimeout
+}
+
 /*
 GetRelayList fetches all the Events of Type 10002 from the relay
+if the relay demands NIP-42 authentication and an authKey is given, the challenge is signed and the request is repeated
+the messages are logged with the attempt of the request, a nil logger uses the default logger
 */
-func GetRelayList(address string) ([]*nostr.Event, error) {
+func GetRelayList(address string, authKey string, logger *slog.Logger) (*RelayListResult, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
 	interrupt := make(chan os.Signal, 1)
 	eventList := make([]*nostr.Event, 0)
+	authStatus := AuthStatusNone
+	timings := NewTimings()
+	var closed, notice string
+	var readErr error
+	timedOut := false
+	result := func() *RelayListResult {
+		return &RelayListResult{Events: eventList, AuthStatus: authStatus, Timings: timings, Closed: closed, Notice: notice, ReadError: readErr, TimedOut: timedOut}
+	}
 	signal.Notify(interrupt, os.Interrupt)
-	c, _, err := websocket.DefaultDialer.Dial(address, nil)
+	c, err := dialWebsocket(address, timings)
 	if err != nil {
-		log.Println("dial:", err)
-		return eventList, err
+		logger.Warn("dialing the relay failed", "error", err, "error_class", ClassifyError(err))
+		return result(), err
 	}
 	defer c.Close()
 
+	// the reader answers AUTH challenges while the main routine sends the REQ, gorilla allows only one writer
+	var writeMutex sync.Mutex
+	write := func(message any) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return c.WriteJSON(message)
+	}
+	filter := nostr.Filter{Kinds: []int{10002}, Limit: 10000}
+	subscription := "1"
+	var attempt sync.Mutex // guards attemptLogger, replaced by the reader when the request is repeated
+	attemptLogger := logger.With("attempt", 1)
+	log := func() *slog.Logger {
+		attempt.Lock()
+		defer attempt.Unlock()
+		return attemptLogger
+	}
+	request := []any{"REQ", subscription, filter}
+	requestStart := time.Now()
+
 	done := make(chan struct{})
 
 	go func() {
 		defer close(done)
+		seen := make(map[string]bool)
+		authEventId := ""
+		authPending := false
+		subscriptionDone := false
 		for {
 			var response []json.RawMessage
 			var messageType string
 			_, message, err := c.ReadMessage()
 			if err != nil {
-				log.Println("read error:", err)
+				log().Debug("reading from the relay stopped", "error", err)
+				readErr = err
 				return
 			}
 			_ = json.Unmarshal(message, &response)
 			if len(response) > 0 {
 				_ = json.Unmarshal(response[0], &messageType)
-				if messageType == "EOSE" {
-					// relay signaled EOSe
+				if messageType == "EOSE" || messageType == "CLOSE" || messageType == "CLOSED" {
+					var subId, reason string
+					if len(response) > 1 {
+						_ = json.Unmarshal(response[1], &subId)
+					}
+					if len(response) > 2 {
+						_ = json.Unmarshal(response[2], &reason)
+					}
+					if subId != "" && subId != subscription {
+						// answer to a subscription we already replaced after authenticating
+						continue
+					}
+					if IsAuthRequiredMessage(reason) && authStatus == AuthStatusNone {
+						authStatus = AuthStatusRequired
+					}
+					if authPending {
+						// wait for the answer to our AUTH before ending the session
+						subscriptionDone = true
+						continue
+					}
+					// relay signaled EOSE or is closing the subscription
 					// no more messages are coming -> closing session
-					done <- struct{}{}
-					return
-				} else if messageType == "CLOSE" || messageType == "CLOSED" {
-					// relay is closing the connection
+					if messageType == "EOSE" {
+						timings.Mark(&timings.EOSE, requestStart)
+					} else {
+						closed = reason
+						if closed == "" {
+							closed = "subscription closed without reason"
+						}
+					}
 					done <- struct{}{}
 					return
 				} else if messageType == "EVENT" {
 					// unmarshall the event
 					var event nostr.Event
 					if err := json.Unmarshal(response[2], &event); err != nil {
-						log.Printf("error while unamrshalling event: %s\n", err)
-
+						log().Debug("event is not valid JSON", "error", err)
+					}
+					timings.Mark(&timings.FirstEvent, requestStart)
+					if event.ID != "" && seen[event.ID] {
+						continue
 					}
+					seen[event.ID] = true
 					eventList = append(eventList, &event)
 				} else if messageType == "NOTICE" {
 					// relay sent a notice
+					if len(response) > 1 {
+						_ = json.Unmarshal(response[1], &notice)
+					}
+					if notice == "" {
+						notice = "NOTICE without message"
+					}
 					done <- struct{}{}
 				} else if messageType == "AUTH" {
-					// relay sent an auth message
-					// we will ignore it for now
+					// relay sent an auth challenge
+					var challenge string
+					if len(response) > 1 {
+						_ = json.Unmarshal(response[1], &challenge)
+					}
+					if authStatus == AuthStatusNone {
+						authStatus = AuthStatusRequired
+					}
+					if authKey == "" || authEventId != "" {
+						continue
+					}
+					authEvent, err := SignAuthEvent(challenge, address, authKey)
+					if err != nil {
+						log().Warn("signing the auth event failed", "error", err)
+						continue
+					}
+					if err := write([]any{"AUTH", authEvent}); err != nil {
+						log().Warn("sending the auth event failed", "error", err)
+						continue
+					}
+					authEventId = authEvent.ID
+					authPending = true
+				} else if messageType == "OK" {
+					var eventId string
+					var accepted bool
+					if len(response) > 2 {
+						_ = json.Unmarshal(response[1], &eventId)
+						_ = json.Unmarshal(response[2], &accepted)
+					}
+					if eventId != authEventId || !authPending {
+						continue
+					}
+					authPending = false
+					if !accepted {
+						authStatus = AuthStatusRejected
+						if subscriptionDone {
+							done <- struct{}{}
+							return
+						}
+						continue
+					}
+					// retry the request now that we are authenticated
+					authStatus = AuthStatusAccepted
+					subscription = "2"
+					subscriptionDone = false
+					attempt.Lock()
+					attemptLogger = logger.With("attempt", 2)
+					attempt.Unlock()
+					if err := write([]any{"REQ", subscription, filter}); err != nil {
+						log().Warn("sending the request failed", "error", err)
+					}
 				} else {
-					// we received a message that is not EOSE or EVENT, e.g. AUTH
-					log.Printf("recv: %s", message)
+					// we received a message that is not handled above
+					log().Debug("unexpected message", "message", string(message))
 				}
 			}
 		}
 	}()
 
-	err = c.WriteMessage(websocket.TextMessage, []byte("[\"REQ\", \"1\", {\"kinds\": [10002], \"limit\": 10000}]"))
+	err = write(request)
 	if err != nil {
-		log.Println("write:", err)
+		log().Warn("sending the request failed", "error", err)
 	}
 
 	go func() {
-		time.Sleep(30 * time.Second)
+		time.Sleep(relayListTimeout)
 		interrupt <- os.Signal(syscall.SIGINT)
 	}()
 
 	for {
 		select {
 		case <-done:
-			return eventList, nil
+			return result(), nil
 		case <-interrupt:
-			log.Println("interrupt")
+			log().Debug("relay list request timed out", "timeout", relayListTimeout)
+			timedOut = true
 
 			// Cleanly close the connection by sending a close message
+			writeMutex.Lock()
 			err := c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			writeMutex.Unlock()
 			if err != nil {
-				log.Println("write close error:", err)
-				return eventList, err
+				log().Warn("closing the connection failed", "error", err)
+				return result(), err
 			}
 			select {
 			case <-done:
 			case <-time.After(time.Second):
 			}
-			return eventList, nil
+			return result(), nil
 		}
 	}
 }
@@ -0,0 +1,347 @@
+package miner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+Event kinds defined by NIP-66
+*/
+const (
+	KindRelayDiscovery      = 30166
+	KindMonitorAnnouncement = 10166
+)
+
+/*
+Publisher signs NIP-66 relay discovery events for the mined relays and sends them to the output relays
+*/
+type Publisher struct {
+	SecretKey string
+	Relays    []string
+	Frequency time.Duration // how often the monitor runs, announced in the kind 10166 event
+	Timeout   time.Duration
+}
+
+/*
+Announce publishes the kind 10166 monitor announcement describing the checks of the miner
+*/
+func (p *Publisher) Announce() error {
+	event := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      KindMonitorAnnouncement,
+		Tags: nostr.Tags{
+			{"frequency", strconv.Itoa(int(p.Frequency.Seconds()))},
+			{"timeout", "open", strconv.Itoa(int(p.timeout().Milliseconds()))},
+			{"timeout", "read", strconv.Itoa(int(p.timeout().Milliseconds()))},
+			{"c", "open"},
+			{"c", "read"},
+			{"c", "nip11"},
+		},
+	}
+	return p.publish(&event)
+}
+
+/*
+PublishRelay measures the round trip times of the relay and publishes the kind 30166 discovery event
+*/
+func (p *Publisher) PublishRelay(rm *RelayMiner) error {
+	rttOpen, rttRead, err := p.measure(rm.Relay)
+	if err != nil {
+		// the relay is not reachable, NIP-66 only describes relays that are online
+		return err
+	}
+	event := p.DiscoveryEvent(rm, rttOpen, rttRead)
+	return p.publish(event)
+}
+
+/*
+DiscoveryEvent builds the unsigned kind 30166 event for the relay from the mined information
+*/
+func (p *Publisher) DiscoveryEvent(rm *RelayMiner, rttOpen time.Duration, rttRead time.Duration) *nostr.Event {
+	event := &nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      KindRelayDiscovery,
+		Tags: nostr.Tags{
+			{"d", nostr.NormalizeURL(rm.Relay)},
+			{"n", helper.NetworkType(rm.Relay)},
+			{"rtt-open", strconv.FormatInt(rttOpen.Milliseconds(), 10)},
+			{"rtt-read", strconv.FormatInt(rttRead.Milliseconds(), 10)},
+		},
+	}
+	for _, nip := range rm.SupportedNips() {
+		event.Tags = append(event.Tags, nostr.Tag{"N", strconv.Itoa(nip)})
+	}
+	if doc := rm.Nip11Document; doc != nil {
+		if json.Valid(rm.nip11Result) {
+			event.Content = string(rm.nip11Result)
+		}
+		requirements := map[string]bool{"auth": false, "payment": false, "writes": false}
+		if doc.Limitation != nil {
+			requirements["auth"] = doc.Limitation.AuthRequired
+			requirements["payment"] = doc.Limitation.PaymentRequired
+			requirements["writes"] = doc.Limitation.RestrictedWrites
+		}
+		for _, requirement := range []string{"auth", "payment", "writes"} {
+			if requirements[requirement] {
+				event.Tags = append(event.Tags, nostr.Tag{"R", requirement})
+			} else {
+				event.Tags = append(event.Tags, nostr.Tag{"R", "!" + requirement})
+			}
+		}
+		for _, tag := range doc.Tags {
+			event.Tags = append(event.Tags, nostr.Tag{"t", tag})
+		}
+		for _, language := range doc.LanguageTags {
+			event.Tags = append(event.Tags, nostr.Tag{"l", language, "ISO-639-1"})
+		}
+	}
+	return event
+}
+
+/*
+measure opens a connection to the relay and times the open and a first read
+*/
+func (p *Publisher) measure(relay string) (time.Duration, time.Duration, error) {
+	start := time.Now()
+	rc, err := connectRelay(relay, "monitor")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rc.Close()
+	rttOpen := time.Since(start)
+
+	start = time.Now()
+	if _, _, err := rc.query("rtt", nostr.Filter{Kinds: []int{1}, Limit: 1}, p.timeout()); err != nil {
+		return rttOpen, 0, err
+	}
+	return rttOpen, time.Since(start), nil
+}
+
+/*
+publish signs the event and sends it to all output relays, failing relays are logged
+*/
+func (p *Publisher) publish(event *nostr.Event) error {
+	if err := event.Sign(p.SecretKey); err != nil {
+		return err
+	}
+	accepted := 0
+	for _, relay := range p.Relays {
+		if err := p.send(relay, event); err != nil {
+			slog.Warn("publishing the NIP-66 event failed", "relay", relay, "kind", event.Kind, "error", err)
+			continue
+		}
+		accepted++
+	}
+	if accepted == 0 && len(p.Relays) > 0 {
+		return fmt.Errorf("no relay accepted the kind %d event", event.Kind)
+	}
+	return nil
+}
+
+/*
+send publishes the event to a single relay and waits for the OK
+*/
+func (p *Publisher) send(relay string, event *nostr.Event) error {
+	rc, err := connectRelay(relay, "monitor")
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := rc.send([]any{"EVENT", event}); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(p.timeout())
+	for {
+		messageType, response, err := rc.receive(deadline)
+		if err != nil {
+			return err
+		}
+		if messageType != "OK" || stringAt(response, 1) != event.ID {
+			continue
+		}
+		var accepted bool
+		if len(response) > 2 {
+			_ = json.Unmarshal(response[2], &accepted)
+		}
+		if !accepted {
+			return fmt.Errorf("event rejected: %s", stringAt(response, 3))
+		}
+		return nil
+	}
+}
+
+func (p *Publisher) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return probeTimeout
+	}
+	return p.Timeout
+}
+
+/*
+MonitorReport holds what a NIP-66 monitor reported about a relay in a kind 30166 event
+*/
+type MonitorReport struct {
+	Monitor      string
+	Relay        string
+	CreatedAt    nostr.Timestamp
+	Network      string
+	Nips         []int
+	Requirements []string
+	Topics       []string
+	RttOpen      int64 // milliseconds, -1 if not reported
+	RttRead      int64
+	RttWrite     int64
+}
+
+/*
+MonitorAnnouncement holds the kind 10166 announcement of a NIP-66 monitor
+*/
+type MonitorAnnouncement struct {
+	Monitor   string
+	CreatedAt nostr.Timestamp
+	Frequency int64
+	Checks    []string
+}
+
+/*
+DiscoverRelays queries the source relays for NIP-66 events and returns the relay reports and monitor announcements
+an error is returned if no source delivered a single event
+*/
+func DiscoverRelays(sources []string, limit int) ([]*MonitorReport, []*MonitorAnnouncement, error) {
+	events := make([]*nostr.Event, 0)
+	var errs []error
+	for _, source := range sources {
+		rc, err := connectRelay(source, "discovery")
+		if err != nil {
+			slog.Warn("NIP-66 source not reachable", "relay", source, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+			continue
+		}
+		found, reason, err := rc.query("nip66", nostr.Filter{Kinds: []int{KindRelayDiscovery, KindMonitorAnnouncement}, Limit: limit}, 30*time.Second)
+		rc.Close()
+		if err != nil || reason != "" {
+			slog.Warn("NIP-66 source failed", "relay", source, "error", err, "reason", reason)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+		} else if reason != "" {
+			errs = append(errs, fmt.Errorf("%s: closed: %s", source, reason))
+		}
+		events = append(events, found...)
+	}
+	if len(events) == 0 {
+		// without a single event the sources failed, even if each of them answered
+		return nil, nil, errors.Join(append(errs, errors.New("no NIP-66 events found"))...)
+	}
+	reports, announcements := ParseNip66Events(events)
+	return reports, announcements, nil
+}
+
+/*
+ParseNip66Events keeps the newest report of every monitor per relay and the newest announcement of every monitor
+the relays are normalised, reports of invalid relay URLs and events with an invalid signature are dropped
+*/
+func ParseNip66Events(events []*nostr.Event) ([]*MonitorReport, []*MonitorAnnouncement) {
+	reports := make([]*MonitorReport, 0)
+	announcements := make([]*MonitorAnnouncement, 0)
+	reportIndex := make(map[string]int)
+	monitorIndex := make(map[string]int)
+	for _, event := range events {
+		if ok, _ := event.CheckSignature(); !ok {
+			continue
+		}
+		switch event.Kind {
+		case KindRelayDiscovery:
+			report := ParseMonitorReport(event)
+			relay, ok := helper.NormalizeRelayURL(report.Relay)
+			if !ok {
+				continue
+			}
+			report.Relay = relay
+			key := report.Monitor + " " + report.Relay
+			if i, seen := reportIndex[key]; !seen {
+				reportIndex[key] = len(reports)
+				reports = append(reports, report)
+			} else if report.CreatedAt > reports[i].CreatedAt {
+				reports[i] = report
+			}
+		case KindMonitorAnnouncement:
+			announcement := ParseMonitorAnnouncement(event)
+			if i, seen := monitorIndex[event.PubKey]; !seen {
+				monitorIndex[event.PubKey] = len(announcements)
+				announcements = append(announcements, announcement)
+			} else if announcement.CreatedAt > announcements[i].CreatedAt {
+				announcements[i] = announcement
+			}
+		}
+	}
+	return reports, announcements
+}
+
+/*
+ParseMonitorReport reads the relay attributes from a kind 30166 event
+*/
+func ParseMonitorReport(event *nostr.Event) *MonitorReport {
+	report := &MonitorReport{
+		Monitor:      event.PubKey,
+		Relay:        event.Tags.GetD(),
+		CreatedAt:    event.CreatedAt,
+		Nips:         make([]int, 0),
+		Requirements: make([]string, 0),
+		Topics:       make([]string, 0),
+		RttOpen:      -1,
+		RttRead:      -1,
+		RttWrite:     -1,
+	}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "n":
+			report.Network = tag[1]
+		case "N":
+			if nip, err := strconv.Atoi(tag[1]); err == nil {
+				report.Nips = append(report.Nips, nip)
+			}
+		case "R":
+			report.Requirements = append(report.Requirements, tag[1])
+		case "t":
+			report.Topics = append(report.Topics, tag[1])
+		case "rtt-open":
+			report.RttOpen, _ = strconv.ParseInt(tag[1], 10, 64)
+		case "rtt-read":
+			report.RttRead, _ = strconv.ParseInt(tag[1], 10, 64)
+		case "rtt-write":
+			report.RttWrite, _ = strconv.ParseInt(tag[1], 10, 64)
+		}
+	}
+	return report
+}
+
+/*
+ParseMonitorAnnouncement reads the frequency and checks from a kind 10166 event
+*/
+func ParseMonitorAnnouncement(event *nostr.Event) *MonitorAnnouncement {
+	announcement := &MonitorAnnouncement{Monitor: event.PubKey, CreatedAt: event.CreatedAt, Checks: make([]string, 0)}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "frequency":
+			announcement.Frequency, _ = strconv.ParseInt(tag[1], 10, 64)
+		case "c":
+			announcement.Checks = append(announcement.Checks, tag[1])
+		}
+	}
+	return announcement
+}
@@ -0,0 +1,124 @@
+package miner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip11"
+)
+
+/*
+TestDiscoveryEvent tests the tags of the kind 30166 event built from a mined relay
+*/
+func TestDiscoveryEvent(t *testing.T) {
+	rm := NewMiner("wss://relay.relay.com")
+	rm.nip11Result = []byte(`{"supported_nips": [1, 42]}`)
+	rm.Nip11Document = &nip11.RelayInformationDocument{
+		SupportedNIPs: []any{float64(1), float64(42)},
+		Limitation:    &nip11.RelayLimitationDocument{AuthRequired: true},
+	}
+	event := (&Publisher{}).DiscoveryEvent(rm, 120*time.Millisecond, 80*time.Millisecond)
+
+	if event.Kind != KindRelayDiscovery {
+		t.Errorf("DiscoveryEvent() kind = %v, want %v", event.Kind, KindRelayDiscovery)
+	}
+	if event.Content != string(rm.nip11Result) {
+		t.Errorf("DiscoveryEvent() content = %v, want %v", event.Content, string(rm.nip11Result))
+	}
+	for _, want := range []nostr.Tag{{"d", "wss://relay.relay.com"}, {"n", "clearnet"}, {"rtt-open", "120"}, {"rtt-read", "80"}, {"N", "42"}, {"R", "auth"}, {"R", "!payment"}} {
+		if event.Tags.FindWithValue(want[0], want[1]) == nil {
+			t.Errorf("DiscoveryEvent() tags = %v, missing %v", event.Tags, want)
+		}
+	}
+}
+
+/*
+TestParseMonitorReport tests reading the relay attributes from a kind 30166 event
+*/
+func TestParseMonitorReport(t *testing.T) {
+	event := &nostr.Event{
+		PubKey: "monitor",
+		Kind:   KindRelayDiscovery,
+		Tags:   nostr.Tags{{"d", "wss://relay.relay.com/"}, {"n", "clearnet"}, {"N", "1"}, {"N", "x"}, {"R", "!auth"}, {"rtt-open", "230"}},
+	}
+	report := ParseMonitorReport(event)
+	if report.Monitor != "monitor" || report.Relay != "wss://relay.relay.com/" || report.Network != "clearnet" {
+		t.Errorf("ParseMonitorReport() = %+v", report)
+	}
+	if len(report.Nips) != 1 || report.Nips[0] != 1 {
+		t.Errorf("ParseMonitorReport() nips = %v, want [1]", report.Nips)
+	}
+	if report.RttOpen != 230 || report.RttRead != -1 {
+		t.Errorf("ParseMonitorReport() rtt = %v/%v, want 230/-1", report.RttOpen, report.RttRead)
+	}
+}
+
+/*
+TestParseNip66Events tests that the newest events are kept and the relays are normalised
+*/
+func TestParseNip66Events(t *testing.T) {
+	secretKey := nostr.GeneratePrivateKey()
+	signed := func(kind int, createdAt nostr.Timestamp, tags nostr.Tags) *nostr.Event {
+		event := &nostr.Event{Kind: kind, CreatedAt: createdAt, Tags: tags}
+		if err := event.Sign(secretKey); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	forged := signed(KindMonitorAnnouncement, 400, nostr.Tags{{"frequency", "1"}})
+	forged.Sig = signed(KindMonitorAnnouncement, 401, nostr.Tags{{"frequency", "1"}}).Sig
+	events := []*nostr.Event{
+		signed(KindRelayDiscovery, 100, nostr.Tags{{"d", "wss://Relay.Example.com/"}, {"n", "tor"}}),
+		signed(KindRelayDiscovery, 200, nostr.Tags{{"d", "wss://relay.example.com"}, {"n", "clearnet"}}),
+		signed(KindRelayDiscovery, 300, nostr.Tags{{"d", "ftp://relay.example.com"}}),
+		signed(KindMonitorAnnouncement, 300, nostr.Tags{{"frequency", "3600"}}),
+		signed(KindMonitorAnnouncement, 100, nostr.Tags{{"frequency", "60"}}),
+		forged,
+	}
+	reports, announcements := ParseNip66Events(events)
+	if len(reports) != 1 || reports[0].Relay != "wss://relay.example.com" || reports[0].Network != "clearnet" {
+		t.Errorf("ParseNip66Events() reports = %+v, want the newest report of wss://relay.example.com", reports)
+	}
+	if len(announcements) != 1 || announcements[0].Frequency != 3600 {
+		t.Errorf("ParseNip66Events() announcements = %+v, want the newest announcement", announcements)
+	}
+}
+
+/*
+TestDiscoverRelays tests that sources without a single event are reported as failed
+*/
+func TestDiscoverRelays(t *testing.T) {
+	report := &nostr.Event{Kind: KindRelayDiscovery, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"d", "wss://relay.example.com"}}}
+	if err := report.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	unreachable := stubRelay(nil)
+	unreachable.Close()
+	tests := []struct {
+		name        string
+		events      []*nostr.Event
+		unreachable bool
+		wantReports int
+		wantErr     bool
+	}{
+		{name: "Discover_Reports", events: []*nostr.Event{report}, wantReports: 1, wantErr: false},
+		{name: "Discover_NoEvents", events: nil, wantReports: 0, wantErr: true},
+		{name: "Discover_Unreachable", unreachable: true, wantReports: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := stubRelay(func(filter nostr.Filter) []*nostr.Event { return tt.events })
+			defer server.Close()
+			source := "ws://" + strings.TrimPrefix(server.URL, "http://")
+			if tt.unreachable {
+				source = "ws://" + strings.TrimPrefix(unreachable.URL, "http://")
+			}
+			reports, _, err := DiscoverRelays([]string{source}, 10)
+			if len(reports) != tt.wantReports || (err != nil) != tt.wantErr {
+				t.Errorf("DiscoverRelays() = %v reports, error %v, want %v reports, wantErr %v", len(reports), err, tt.wantReports, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package miner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+Results of the active verification of a claimed NIP
+*/
+const (
+	ProbeVerified     = "verified"     // the relay behaved as the NIP demands
+	ProbeFailed       = "failed"       // the relay refused or violated the NIP
+	ProbeInconclusive = "inconclusive" // the relay gave no data to decide on
+	ProbeError        = "error"        // the probe itself could not be run
+)
+
+/*
+NipVerification holds the outcome of probing a relay for a NIP it advertises
+*/
+type NipVerification struct {
+	Nip    int
+	Result string
+	Error  string
+}
+
+/*
+Verified returns true if the probe confirmed the claim
+*/
+func (v *NipVerification) Verified() bool {
+	return v.Result == ProbeVerified
+}
+
+/*
+nipProbe runs a probe against the relay and returns the result with an explanation
+*/
+type nipProbe func(rm *RelayMiner) (string, string)
+
+/*
+nipProbes holds the probes for the NIPs that can be actively verified
+*/
+var nipProbes = map[int]nipProbe{
+	9:  probeDeletion,
+	40: probeExpiration,
+	42: probeAuth,
+	45: probeCount,
+	50: probeSearch,
+}
+
+/*
+VerifyNips probes the relay for every verifiable NIP it advertises in the NIP-11 document
+*/
+func (rm *RelayMiner) VerifyNips() {
+	rm.NipVerifications = make([]*NipVerification, 0)
+	for _, nip := range rm.SupportedNips() {
+		probe, ok := nipProbes[nip]
+		if !ok {
+			continue
+		}
+		result, reason := probe(rm)
+		rm.NipVerifications = append(rm.NipVerifications, &NipVerification{Nip: nip, Result: result, Error: reason})
+	}
+}
+
+/*
+withConnection opens a fresh connection for a probe and maps connection errors to the error result
+*/
+func withConnection(rm *RelayMiner, probe func(rc *relayConnection) (string, string)) (string, string) {
+	rc, err := connectRelay(rm.Relay, "probe")
+	if err != nil {
+		return ProbeError, err.Error()
+	}
+	defer rc.Close()
+	return probe(rc)
+}
+
+/*
+probeError maps an error of a request to the probe result, a missing answer counts as failure
+*/
+func probeError(err error) (string, string) {
+	if errors.Is(err, errNoResponse) {
+		return ProbeFailed, err.Error()
+	}
+	return ProbeError, err.Error()
+}
+
+/*
+probeCount checks NIP-45 by sending a COUNT and expecting a count in return
+*/
+func probeCount(rm *RelayMiner) (string, string) {
+	return withConnection(rm, func(rc *relayConnection) (string, string) {
+		count, reason, err := rc.count("count", nostr.Filter{Kinds: []int{1}}, probeTimeout)
+		if err != nil {
+			return probeError(err)
+		}
+		if reason != "" {
+			return ProbeFailed, reason
+		}
+		return ProbeVerified, fmt.Sprintf("count %v", count)
+	})
+}
+
+/*
+searchNonsense is a search term no event is expected to match, used to detect relays ignoring the search
+*/
+const searchNonsense = "qxzvkwjpartiominer"
+
+/*
+probeSearch checks NIP-50 by searching for a common term and for a nonsense term
+relays may match on tokens or stems, so the results are not compared to the term, but a relay returning events
+for the nonsense term ignores the search and returns unrelated results
+*/
+func probeSearch(rm *RelayMiner) (string, string) {
+	return withConnection(rm, func(rc *relayConnection) (string, string) {
+		events, reason, err := rc.query("search", nostr.Filter{Kinds: []int{1}, Search: "nostr", Limit: 10}, probeTimeout)
+		if err != nil {
+			return probeError(err)
+		}
+		if reason != "" {
+			return ProbeFailed, reason
+		}
+		if len(events) == 0 {
+			return ProbeInconclusive, "no events returned for the search"
+		}
+		unrelated, reason, err := rc.query("nonsense", nostr.Filter{Kinds: []int{1}, Search: searchNonsense, Limit: 10}, probeTimeout)
+		if err != nil {
+			return probeError(err)
+		}
+		if reason != "" {
+			return ProbeFailed, reason
+		}
+		for _, event := range unrelated {
+			if !strings.Contains(strings.ToLower(event.Content), searchNonsense) {
+				return ProbeFailed, fmt.Sprintf("event %v is returned for a search nothing matches", event.ID)
+			}
+		}
+		return ProbeVerified, fmt.Sprintf("%v events found, none for a search nothing matches", len(events))
+	})
+}
+
+/*
+probeExpiration checks NIP-40 by sampling events and looking for events served after their expiration
+*/
+func probeExpiration(rm *RelayMiner) (string, string) {
+	return withConnection(rm, func(rc *relayConnection) (string, string) {
+		events, reason, err := rc.query("expiration", nostr.Filter{Limit: 500}, probeTimeout)
+		if err != nil {
+			return probeError(err)
+		}
+		if reason != "" {
+			return ProbeError, reason
+		}
+		now := nostr.Now()
+		withExpiration := 0
+		for _, event := range events {
+			tag := event.Tags.Find("expiration")
+			if tag == nil {
+				continue
+			}
+			withExpiration++
+			var expiration int64
+			if _, err := fmt.Sscan(tag[1], &expiration); err == nil && nostr.Timestamp(expiration) < now {
+				return ProbeFailed, fmt.Sprintf("event %v is served after its expiration", event.ID)
+			}
+		}
+		if withExpiration == 0 {
+			return ProbeInconclusive, fmt.Sprintf("none of %v sampled events carries an expiration", len(events))
+		}
+		return ProbeVerified, fmt.Sprintf("%v sampled events with expiration are not expired", withExpiration)
+	})
+}
+
+/*
+probeDeletion checks NIP-09 by looking up the events referenced by deletion requests of their own author
+*/
+func probeDeletion(rm *RelayMiner) (string, string) {
+	return withConnection(rm, func(rc *relayConnection) (string, string) {
+		deletions, reason, err := rc.query("deletions", nostr.Filter{Kinds: []int{5}, Limit: 50}, probeTimeout)
+		if err != nil {
+			return probeError(err)
+		}
+		if reason != "" {
+			return ProbeError, reason
+		}
+		deletedBy := make(map[string]string)
+		ids := make([]string, 0)
+		for _, deletion := range deletions {
+			for tag := range deletion.Tags.FindAll("e") {
+				if nostr.IsValid32ByteHex(tag[1]) {
+					deletedBy[tag[1]] = deletion.PubKey
+					ids = append(ids, tag[1])
+				}
+			}
+		}
+		if len(ids) == 0 {
+			return ProbeInconclusive, "no deletion requests found"
+		}
+		events, reason, err := rc.query("deleted", nostr.Filter{IDs: ids}, probeTimeout)
+		if err != nil {
+			return probeError(err)
+		}
+		if reason != "" {
+			return ProbeError, reason
+		}
+		for _, event := range events {
+			if deletedBy[event.ID] == event.PubKey {
+				return ProbeFailed, fmt.Sprintf("event %v is served after its deletion", event.ID)
+			}
+		}
+		// an event that is not served may never have been stored, replies and reactions on the relay show it was
+		references, _, err := rc.query("references", nostr.Filter{Tags: nostr.TagMap{"e": ids}, Limit: 500}, probeTimeout)
+		if err != nil && !errors.Is(err, errNoResponse) {
+			return probeError(err)
+		}
+		stored := make(map[string]bool)
+		for _, reference := range references {
+			if reference.Kind == 5 {
+				continue
+			}
+			for tag := range reference.Tags.FindAll("e") {
+				if _, deleted := deletedBy[tag[1]]; deleted {
+					stored[tag[1]] = true
+				}
+			}
+		}
+		if len(stored) == 0 {
+			return ProbeInconclusive, fmt.Sprintf("none of %v deleted events is served, but none is known to have been stored", len(ids))
+		}
+		return ProbeVerified, fmt.Sprintf("%v deleted events referenced on the relay are not served", len(stored))
+	})
+}
+
+/*
+probeAuth checks NIP-42 by waiting for an AUTH challenge, either from the relay list request or a fresh connection
+*/
+func probeAuth(rm *RelayMiner) (string, string) {
+	if rm.AuthStatus != "" && rm.AuthStatus != AuthStatusNone {
+		return ProbeVerified, fmt.Sprintf("relay sent a challenge, auth %v", rm.AuthStatus)
+	}
+	return withConnection(rm, func(rc *relayConnection) (string, string) {
+		_, reason, err := rc.query("auth", nostr.Filter{Kinds: []int{4}, Limit: 1}, probeTimeout)
+		if rc.challenge != "" {
+			return ProbeVerified, "relay sent a challenge"
+		}
+		if IsAuthRequiredMessage(reason) {
+			return ProbeFailed, "relay requires auth but sent no challenge: " + reason
+		}
+		if err != nil && !errors.Is(err, errNoResponse) {
+			return ProbeError, err.Error()
+		}
+		return ProbeInconclusive, "relay sent no challenge"
+	})
+}
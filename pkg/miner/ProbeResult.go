@@ -0,0 +1,248 @@
+package miner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+Statuses of a stage of the ProbeResult
+*/
+const (
+	StageOk      = "ok"
+	StageSkipped = "skipped"
+	StageFailed  = "failed"
+)
+
+/*
+Classes of the errors of a failed stage
+the DNS classes of the resolver are prefixed with dns_, e.g. dns_nxdomain or dns_servfail
+*/
+const (
+	ErrorInvalidURL      = "invalid_url"
+	ErrorLocalAddress    = "local_address" // private, loopback or carrier-grade NAT address
+	ErrorHiddenService   = "hidden_service"
+	ErrorPolicy          = "excluded_by_policy"
+	ErrorDnsNxDomain     = "dns_nxdomain"
+	ErrorDnsTimeout      = "dns_timeout"
+	ErrorDns             = "dns_error"
+	ErrorTcpRefused      = "tcp_refused"
+	ErrorTcpReset        = "tcp_reset"
+	ErrorNetwork         = "network_error"
+	ErrorTLS             = "tls_error"
+	ErrorTimeout         = "timeout"
+	ErrorHttp4xx         = "http_4xx"
+	ErrorHttp5xx         = "http_5xx"
+	ErrorHttp            = "http_error" // any other status outside of 2xx
+	ErrorInvalidDocument = "invalid_document"
+	ErrorWsHandshake     = "ws_handshake"
+	ErrorClosedByRelay   = "closed_by_relay"
+	ErrorNotice          = "notice"
+	ErrorAuthRequired    = "auth_required"
+	ErrorAuthRejected    = "auth_rejected"
+	ErrorOther           = "other"
+)
+
+/*
+StageResult holds how a single stage of loading a relay went
+*/
+type StageResult struct {
+	Stage      string  `json:"stage"`
+	Status     string  `json:"status"`
+	ErrorClass string  `json:"errorClass,omitempty"`
+	Error      string  `json:"error,omitempty"`  // raw error message of a failed stage
+	Reason     string  `json:"reason,omitempty"` // why the stage was skipped
+	DurationMs float64 `json:"durationMs"`
+}
+
+/*
+ProbeResult holds the outcome of every stage of loading a relay, the first failure is lifted to the relay
+*/
+type ProbeResult struct {
+	Relay      string         `json:"relay"`
+	Valid      bool           `json:"valid"`
+	ErrorClass string         `json:"errorClass,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  time.Time      `json:"startedAt"`
+	DurationMs float64        `json:"durationMs"`
+	Stages     []*StageResult `json:"stages"`
+}
+
+/*
+Stage returns the result of the named stage or nil if it was not recorded
+*/
+func (p *ProbeResult) Stage(name string) *StageResult {
+	for _, stage := range p.Stages {
+		if stage.Stage == name {
+			return stage
+		}
+	}
+	return nil
+}
+
+/*
+finish sets the validity, the duration and the error of the first failed stage
+*/
+func (p *ProbeResult) finish(valid bool, duration time.Duration) {
+	p.Valid = valid
+	p.DurationMs = milliseconds(duration)
+	for _, stage := range p.Stages {
+		if stage.Status == StageFailed {
+			p.ErrorClass, p.Error = stage.ErrorClass, stage.Error
+			return
+		}
+	}
+}
+
+/*
+fail marks the current stage of the relay as failed, outside of Load nothing is recorded
+*/
+func (rm *RelayMiner) fail(class string, message string) {
+	if rm.currentStage == nil {
+		return
+	}
+	rm.currentStage.Status, rm.currentStage.ErrorClass, rm.currentStage.Error = StageFailed, class, message
+}
+
+/*
+skipCurrent marks the current stage of the relay as skipped
+*/
+func (rm *RelayMiner) skipCurrent(reason string) {
+	if rm.currentStage == nil {
+		return
+	}
+	rm.currentStage.Status, rm.currentStage.Reason = StageSkipped, reason
+}
+
+/*
+skip records stages that are not run
+*/
+func (rm *RelayMiner) skip(reason string, stages ...string) {
+	for _, name := range stages {
+		rm.Probe.Stages = append(rm.Probe.Stages, &StageResult{Stage: name, Status: StageSkipped, Reason: reason})
+	}
+}
+
+/*
+excludedProbe records the probe of a relay excluded before it is loaded, only the validation failed
+*/
+func (rm *RelayMiner) excludedProbe() {
+	validate := &StageResult{Stage: "validate", Status: StageFailed, ErrorClass: ErrorPolicy, Error: rm.ExcludedBy}
+	rm.Probe = &ProbeResult{Relay: rm.Relay, StartedAt: time.Now(), Stages: []*StageResult{validate}}
+	rm.skip("relay is not valid", "nip11", "certificate", "relaylist", "probe", "census")
+	rm.Probe.finish(false, 0)
+}
+
+/*
+ClassifyError maps the error of a connection or request to a relay to its error class
+*/
+func ClassifyError(err error) string {
+	var dnsErr *net.DNSError
+	var closeErr *websocket.CloseError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, websocket.ErrBadHandshake):
+		return ErrorWsHandshake
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsNotFound {
+			return ErrorDnsNxDomain
+		}
+		if dnsErr.IsTimeout {
+			return ErrorDnsTimeout
+		}
+		return ErrorDns
+	case isTLSError(err):
+		return ErrorTLS
+	case errors.Is(err, errNoResponse), errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorTcpRefused
+	case errors.Is(err, syscall.ECONNRESET):
+		return ErrorTcpReset
+	case errors.As(err, &closeErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClosedByRelay
+	case errors.As(err, &opErr):
+		return ErrorNetwork
+	default:
+		return ErrorOther
+	}
+}
+
+/*
+isTLSError reports whether the error comes from the TLS handshake or the certificate verification
+*/
+func isTLSError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return true
+	}
+	// the remote alerts and handshake failures are not typed
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+/*
+dnsErrorClass maps the class of a failed resolution to the error class
+*/
+func dnsErrorClass(class string) string {
+	return "dns_" + class
+}
+
+/*
+validationErrorClass maps the reason helper.ValidateURL rejected a relay with to the error class
+*/
+func validationErrorClass(reason string) string {
+	switch reason {
+	case "Invalid URL":
+		return ErrorInvalidURL
+	case "Private IP address", "Loopback IP address", "Carrier-Grade NAT IP address":
+		return ErrorLocalAddress
+	case "TOR network address":
+		return ErrorHiddenService
+	default:
+		return ErrorOther
+	}
+}
+
+/*
+httpErrorClass maps an HTTP status outside of 2xx to the error class
+*/
+func httpErrorClass(status int) string {
+	switch {
+	case status >= 400 && status < 500:
+		return ErrorHttp4xx
+	case status >= 500 && status < 600:
+		return ErrorHttp5xx
+	default:
+		return ErrorHttp
+	}
+}
+
+/*
+httpStatusMessage describes an HTTP status as error message
+*/
+func httpStatusMessage(status int) string {
+	return fmt.Sprintf("HTTP status %d", status)
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
@@ -0,0 +1,135 @@
+package miner
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+TestClassifyError tests the classification of failed requests, failed dials are covered by TestDialErrorClass
+*/
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "Class_None", err: nil, want: ""},
+		{name: "Class_NoResponse", err: errNoResponse, want: ErrorTimeout},
+		{name: "Class_Deadline", err: fmt.Errorf("request: %w", context.DeadlineExceeded), want: ErrorTimeout},
+		{name: "Class_DnsTimeout", err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}, want: ErrorDnsTimeout},
+		{name: "Class_Certificate", err: x509.UnknownAuthorityError{}, want: ErrorTLS},
+		{name: "Class_TlsAlert", err: fmt.Errorf("remote error: tls: handshake failure"), want: ErrorTLS},
+		{name: "Class_Close", err: &websocket.CloseError{Code: websocket.CloseGoingAway}, want: ErrorClosedByRelay},
+		{name: "Class_EOF", err: io.ErrUnexpectedEOF, want: ErrorClosedByRelay},
+		{name: "Class_Other", err: fmt.Errorf("malformed COUNT response"), want: ErrorOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestLoad_ProbeResult tests the stages recorded for relays that are not valid
+*/
+func TestLoad_ProbeResult(t *testing.T) {
+	tests := []struct {
+		name      string
+		relay     string
+		wantClass string
+	}{
+		{name: "Probe_Loopback", relay: "ws://127.0.0.1:7777", wantClass: ErrorLocalAddress},
+		{name: "Probe_Private", relay: "wss://192.168.1.10/", wantClass: ErrorLocalAddress},
+		{name: "Probe_Nxdomain", relay: "wss://relay.invalid/", wantClass: ErrorDnsNxDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := NewMiner(tt.relay)
+			rm.Load()
+			probe := rm.Probe
+			if probe == nil || probe.Valid || probe.ErrorClass != tt.wantClass || probe.Error == "" {
+				t.Fatalf("Load() probe = %+v, want invalid with %v", probe, tt.wantClass)
+			}
+			validate := probe.Stage("validate")
+			if validate == nil || validate.Status != StageFailed || validate.ErrorClass != tt.wantClass {
+				t.Errorf("validate stage = %+v, want failed with %v", validate, tt.wantClass)
+			}
+			for _, name := range []string{"nip11", "certificate", "relaylist", "probe", "census"} {
+				if stage := probe.Stage(name); stage == nil || stage.Status != StageSkipped {
+					t.Errorf("%s stage = %+v, want skipped", name, stage)
+				}
+			}
+		})
+	}
+}
+
+/*
+TestExcludedProbe tests the stages recorded for relays excluded before they are loaded
+*/
+func TestExcludedProbe(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{name: "Excluded_Deny", rule: "deny *.example.com"},
+		{name: "Excluded_NotAllowed", rule: "not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := NewMiner("wss://relay.example.com")
+			rm.ExcludedBy = tt.rule
+			rm.excludedProbe()
+			probe := rm.Probe
+			if probe.Valid || probe.ErrorClass != ErrorPolicy || probe.Error != tt.rule {
+				t.Fatalf("excludedProbe() probe = %+v, want invalid with %v", probe, ErrorPolicy)
+			}
+			if validate := probe.Stage("validate"); validate == nil || validate.Status != StageFailed {
+				t.Errorf("validate stage = %+v, want failed", validate)
+			}
+			for _, name := range []string{"nip11", "certificate", "relaylist", "probe", "census"} {
+				if stage := probe.Stage(name); stage == nil || stage.Status != StageSkipped {
+					t.Errorf("%s stage = %+v, want skipped", name, stage)
+				}
+			}
+		})
+	}
+}
+
+/*
+TestFailRelayList tests the error classes of relay list requests that ended without EOSE
+*/
+func TestFailRelayList(t *testing.T) {
+	tests := []struct {
+		name   string
+		result RelayListResult
+		want   string
+	}{
+		{name: "RelayList_Eose", result: RelayListResult{AuthStatus: AuthStatusNone}, want: ""},
+		{name: "RelayList_AuthRequired", result: RelayListResult{AuthStatus: AuthStatusRequired, Closed: "auth-required: sign in"}, want: ErrorAuthRequired},
+		{name: "RelayList_AuthRejected", result: RelayListResult{AuthStatus: AuthStatusRejected}, want: ErrorAuthRejected},
+		{name: "RelayList_Closed", result: RelayListResult{AuthStatus: AuthStatusNone, Closed: "error: shutting down"}, want: ErrorClosedByRelay},
+		{name: "RelayList_Notice", result: RelayListResult{AuthStatus: AuthStatusNone, Notice: "rate limited"}, want: ErrorNotice},
+		{name: "RelayList_ReadError", result: RelayListResult{AuthStatus: AuthStatusNone, ReadError: io.ErrUnexpectedEOF}, want: ErrorClosedByRelay},
+		{name: "RelayList_TimedOut", result: RelayListResult{AuthStatus: AuthStatusNone, TimedOut: true}, want: ErrorTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := NewMiner("wss://relay.example.com")
+			rm.currentStage = &StageResult{Stage: "relaylist", Status: StageOk}
+			rm.failRelayList(&tt.result)
+			if rm.currentStage.ErrorClass != tt.want || (tt.want == "") != (rm.currentStage.Status == StageOk) {
+				t.Errorf("failRelayList() stage = %+v, want %v", rm.currentStage, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package miner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+stubRelay answers every REQ with the events returned by the handler followed by EOSE
+*/
+func stubRelay(handler func(filter nostr.Filter) []*nostr.Event) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			var message []json.RawMessage
+			if err := c.ReadJSON(&message); err != nil {
+				return
+			}
+			if len(message) < 3 {
+				// CLOSE of a finished subscription
+				continue
+			}
+			var messageType, subscription string
+			var filter nostr.Filter
+			_ = json.Unmarshal(message[0], &messageType)
+			_ = json.Unmarshal(message[1], &subscription)
+			if messageType != "REQ" || json.Unmarshal(message[2], &filter) != nil {
+				continue
+			}
+			for _, event := range handler(filter) {
+				_ = c.WriteJSON([]any{"EVENT", subscription, event})
+			}
+			_ = c.WriteJSON([]any{"EOSE", subscription})
+		}
+	}))
+}
+
+/*
+TestProbeSearch tests that the NIP-50 probe accepts stemmed matches and fails relays ignoring the search
+*/
+func TestProbeSearch(t *testing.T) {
+	stemmed := []*nostr.Event{{ID: "a", Kind: 1, Content: "Nostr's relays are great"}, {ID: "b", Kind: 1, Content: "#NOSTRICH"}}
+	tests := []struct {
+		name    string
+		handler func(filter nostr.Filter) []*nostr.Event
+		want    string
+	}{
+		{name: "Search_Stemmed", handler: func(filter nostr.Filter) []*nostr.Event {
+			if filter.Search == "nostr" {
+				return stemmed
+			}
+			return nil
+		}, want: ProbeVerified},
+		{name: "Search_Ignored", handler: func(filter nostr.Filter) []*nostr.Event { return stemmed }, want: ProbeFailed},
+		{name: "Search_Empty", handler: func(filter nostr.Filter) []*nostr.Event { return nil }, want: ProbeInconclusive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := stubRelay(tt.handler)
+			defer server.Close()
+			rm := NewMiner("ws://" + strings.TrimPrefix(server.URL, "http://"))
+			if got, reason := probeSearch(rm); got != tt.want {
+				t.Errorf("probeSearch() = %v (%v), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestProbeDeletion tests that deleted events are only counted as removed if the relay is known to have stored them
+*/
+func TestProbeDeletion(t *testing.T) {
+	deletedId := strings.Repeat("ab", 32)
+	deletion := &nostr.Event{ID: strings.Repeat("cd", 32), Kind: 5, PubKey: "author", Tags: nostr.Tags{{"e", deletedId}}}
+	deleted := &nostr.Event{ID: deletedId, Kind: 1, PubKey: "author"}
+	reaction := &nostr.Event{ID: strings.Repeat("ef", 32), Kind: 7, PubKey: "other", Tags: nostr.Tags{{"e", deletedId}}}
+	tests := []struct {
+		name       string
+		served     bool
+		referenced bool
+		want       string
+	}{
+		{name: "Deletion_Removed", referenced: true, want: ProbeVerified},
+		{name: "Deletion_NeverStored", want: ProbeInconclusive},
+		{name: "Deletion_Served", served: true, referenced: true, want: ProbeFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := stubRelay(func(filter nostr.Filter) []*nostr.Event {
+				switch {
+				case len(filter.Kinds) == 1 && filter.Kinds[0] == 5:
+					return []*nostr.Event{deletion}
+				case len(filter.IDs) > 0 && tt.served:
+					return []*nostr.Event{deleted}
+				case len(filter.Tags["e"]) > 0 && tt.referenced:
+					return []*nostr.Event{deletion, reaction}
+				}
+				return nil
+			})
+			defer server.Close()
+			rm := NewMiner("ws://" + strings.TrimPrefix(server.URL, "http://"))
+			if got, reason := probeDeletion(rm); got != tt.want {
+				t.Errorf("probeDeletion() = %v (%v), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package miner
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+)
+
+/*
+hiddenServiceProxy is the SOCKS5 proxy used to reach .onion and .i2p relays, nil if hidden services are not mined
+*/
+var hiddenServiceProxy *url.URL
+
+/*
+SetProxy configures the SOCKS5 proxy (e.g. a local Tor daemon at socks5://127.0.0.1:9050) for hidden service relays
+an empty address disables mining hidden services
+*/
+func SetProxy(address string) error {
+	if address == "" {
+		hiddenServiceProxy = nil
+		return nil
+	}
+	proxy, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	if proxy.Scheme != "socks5" && proxy.Scheme != "socks5h" {
+		return fmt.Errorf("proxy %s is not a socks5 proxy", address)
+	}
+	// the websocket dialer only knows socks5, which passes the hostname to the proxy like socks5h
+	proxy.Scheme = "socks5"
+	hiddenServiceProxy = proxy
+	return nil
+}
+
+/*
+IsHiddenService returns true for relays on the tor or i2p network
+*/
+func IsHiddenService(relay string) bool {
+	network := helper.NetworkType(relay)
+	return network == "tor" || network == "i2p"
+}
+
+/*
+proxyFor returns the proxy function for requests to the relay, nil for a direct connection
+*/
+func proxyFor(relay string) func(*http.Request) (*url.URL, error) {
+	if hiddenServiceProxy == nil || !IsHiddenService(relay) {
+		return nil
+	}
+	return http.ProxyURL(hiddenServiceProxy)
+}
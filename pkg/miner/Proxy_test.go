@@ -0,0 +1,158 @@
+package miner
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+TestValidateHiddenService tests that hidden services are only mined if a proxy is configured
+*/
+func TestValidateHiddenService(t *testing.T) {
+	defer SetProxy("")
+	tests := []struct {
+		name  string
+		proxy string
+		relay string
+		want  bool
+	}{
+		{name: "Onion_NoProxy", proxy: "", relay: "ws://abcdefghijklmnop.onion", want: false},
+		{name: "Onion_Proxy", proxy: "socks5://127.0.0.1:9050", relay: "ws://abcdefghijklmnop.onion", want: true},
+		{name: "I2P_Proxy", proxy: "socks5://127.0.0.1:4447", relay: "wss://relay.i2p", want: true},
+		{name: "Onion_Proxy_InvalidURL", proxy: "socks5://127.0.0.1:9050", relay: "abcdefghijklmnop.onion", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetProxy(tt.proxy); err != nil {
+				t.Fatalf("SetProxy() error = %v", err)
+			}
+			rm := NewMiner(tt.relay)
+			rm.Validate()
+			if rm.IsValid != tt.want {
+				t.Errorf("Validate() = %v (%v), want %v", rm.IsValid, rm.InvalidReason, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestSetProxy tests that only socks5 proxies are accepted
+*/
+func TestSetProxy(t *testing.T) {
+	defer SetProxy("")
+	tests := []struct {
+		name    string
+		proxy   string
+		wantErr bool
+	}{
+		{name: "Socks5", proxy: "socks5://127.0.0.1:9050", wantErr: false},
+		{name: "Socks5h", proxy: "socks5h://127.0.0.1:9050", wantErr: false},
+		{name: "Empty", proxy: "", wantErr: false},
+		{name: "Http", proxy: "http://127.0.0.1:8080", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetProxy(tt.proxy); (err != nil) != tt.wantErr {
+				t.Errorf("SetProxy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+/*
+stubSocks5 accepts SOCKS5 CONNECT requests without authentication, sends the requested host to hosts
+and forwards the connection to target regardless of the host
+*/
+func stubSocks5(t *testing.T, target string, hosts chan<- string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer client.Close()
+				// greeting: version, number of methods, methods
+				header := make([]byte, 2)
+				if _, err := io.ReadFull(client, header); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(client, make([]byte, header[1])); err != nil {
+					return
+				}
+				_, _ = client.Write([]byte{5, 0})
+				// request: version, command, reserved, address type, address, port
+				request := make([]byte, 4)
+				if _, err := io.ReadFull(client, request); err != nil || request[3] != 3 {
+					return
+				}
+				length := make([]byte, 1)
+				if _, err := io.ReadFull(client, length); err != nil {
+					return
+				}
+				host := make([]byte, int(length[0])+2)
+				if _, err := io.ReadFull(client, host); err != nil {
+					return
+				}
+				hosts <- string(host[:length[0]])
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				_, _ = client.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go func() { _, _ = io.Copy(upstream, client) }()
+				_, _ = io.Copy(client, upstream)
+			}()
+		}
+	}()
+	return listener
+}
+
+/*
+TestConnectRelay_Proxy tests that hidden services are dialed through the proxy, which resolves the hostname
+*/
+func TestConnectRelay_Proxy(t *testing.T) {
+	defer SetProxy("")
+	server := stubRelay(func(filter nostr.Filter) []*nostr.Event {
+		return []*nostr.Event{{ID: "a", Kind: 1}}
+	})
+	defer server.Close()
+	tests := []struct {
+		name   string
+		scheme string
+	}{
+		{name: "Proxy_Socks5", scheme: "socks5"},
+		{name: "Proxy_Socks5h", scheme: "socks5h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := make(chan string, 1)
+			listener := stubSocks5(t, strings.TrimPrefix(server.URL, "http://"), hosts)
+			defer listener.Close()
+			if err := SetProxy(tt.scheme + "://" + listener.Addr().String()); err != nil {
+				t.Fatalf("SetProxy() error = %v", err)
+			}
+			rc, err := connectRelay("ws://abcdefghijklmnop.onion", "probe")
+			if err != nil {
+				t.Fatalf("connectRelay() error = %v", err)
+			}
+			defer rc.Close()
+			if host := <-hosts; host != "abcdefghijklmnop.onion" {
+				t.Errorf("proxy host = %v, want abcdefghijklmnop.onion", host)
+			}
+			events, _, err := rc.query("proxy", nostr.Filter{Kinds: []int{1}}, probeTimeout)
+			if err != nil || len(events) != 1 {
+				t.Errorf("query() = %v, %v, want 1 event", len(events), err)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package miner
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/metrics"
+)
 
 type Queue struct {
 	relayMiners []*RelayMiner
@@ -12,6 +16,8 @@ func (q *Queue) IsEmpty() bool {
 }
 
 func (q *Queue) Length() int {
+	q.Lock()
+	defer q.Unlock()
 	return len(q.relayMiners)
 }
 
@@ -19,6 +25,7 @@ func (q *Queue) Enqueue(rm *RelayMiner) {
 	q.Lock()
 	defer q.Unlock()
 	q.relayMiners = append(q.relayMiners, rm)
+	metrics.QueueLength.Set(float64(len(q.relayMiners)))
 }
 
 func (q *Queue) Dequeue() *RelayMiner {
@@ -29,5 +36,6 @@ func (q *Queue) Dequeue() *RelayMiner {
 	}
 	rm := q.relayMiners[0]
 	q.relayMiners = q.relayMiners[1:]
+	metrics.QueueLength.Set(float64(len(q.relayMiners)))
 	return rm
 }
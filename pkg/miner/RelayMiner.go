@@ -2,12 +2,18 @@ package miner
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+	"github.com/SEG-UNIBE/artio-miner/pkg/metrics"
+	"github.com/SEG-UNIBE/artio-miner/pkg/policy"
+	"github.com/SEG-UNIBE/artio-miner/pkg/resolver"
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip11"
 )
@@ -20,6 +26,7 @@ type RelayMiner struct {
 	EventList        []*nostr.Event
 	nip11Result      []byte // store both the raw result and the parsed to keep information that might not be compliant with NIP-11
 	Nip11Document    *nip11.RelayInformationDocument
+	Nip11Validation  *Nip11Validation
 	NeighbourRelays  []string
 	Ips              []net.IP
 	DnsInValidReason string
@@ -28,44 +35,156 @@ type RelayMiner struct {
 	InvalidReason    string
 	DetectedBy       *RelayMiner
 	RecursionLevel   int
+	AuthKey          string // secret key used to answer NIP-42 challenges, empty disables authentication
+	AuthStatus       string
+	ProbeNips        bool // actively verify the NIPs claimed in the NIP-11 document
+	NipVerifications []*NipVerification
+	Nip11Timings     *Timings
+	RelayListTimings *Timings
+	Certificate      *CertificateInfo
+	CertificateError string
+	Census           bool // estimate the number of events per kind on the relay
+	KindCensus       []*KindCount
+	DNS              *resolver.Resolution
+	Policy           *policy.Policy // allow and deny rules checked before and after resolving the relay
+	ExcludedBy       string         // the rule that excluded the relay
+	Logger           *slog.Logger   // carries the crawl and runner, the default logger is used if nil
+	Probe            *ProbeResult   // how every stage of Load went
+	currentStage     *StageResult
+}
+
+/*
+dnsResolver resolves the relay hostnames, the upstream can be changed with SetDNSServer
+*/
+var dnsResolver = &resolver.Resolver{}
+
+/*
+SetDNSServer sets the upstream DNS server used to resolve the relays, empty uses the system configuration
+*/
+func SetDNSServer(server string) {
+	dnsResolver = &resolver.Resolver{Server: server}
 }
 
 func (rm *RelayMiner) Load() {
-	defer func() { rm.loaded = true }()
-	rm.IsValid, rm.InvalidReason = helper.ValidateURL(rm.Relay)
+	start := time.Now()
+	rm.Probe = &ProbeResult{Relay: rm.Relay, StartedAt: start, Stages: make([]*StageResult, 0)}
+	defer func() {
+		rm.loaded = true
+		rm.Probe.finish(rm.IsValid, time.Since(start))
+	}()
+	rm.stage("validate", rm.Validate)
 	if !rm.IsValid {
-		log.Println(rm.InvalidReason, ": ", rm.Relay)
-		return
-	}
-	rm.Ips, rm.DnsInValidReason = helper.ValidateDNS(rm.CleanName())
-	if rm.DnsInValidReason != "" {
-		rm.IsValid = false
-		rm.InvalidReason = rm.DnsInValidReason
-		log.Println(rm.DnsInValidReason, ": ", rm.Relay)
+		rm.skip("relay is not valid", "nip11", "certificate", "relaylist", "probe", "census")
 		return
 	}
 
-	rm.LoadNIP11()
+	rm.stage("nip11", rm.LoadNIP11)
+	rm.stage("certificate", rm.LoadCertificate)
 	if rm.RecursionLevel > 0 {
-		rm.LoadRelayLists()
+		rm.stage("relaylist", rm.LoadRelayLists)
 		rm.LoadNeighbouringRelays()
+	} else {
+		rm.skip("recursion limit reached", "relaylist")
+	}
+	if rm.ProbeNips {
+		rm.stage("probe", rm.VerifyNips)
+	} else {
+		rm.skip("not enabled", "probe")
+	}
+	if rm.Census {
+		rm.stage("census", rm.LoadCensus)
+	} else {
+		rm.skip("not enabled", "census")
 	}
 }
 
+/*
+stage runs a stage of loading a relay and records its result and duration, the messages logged meanwhile carry the stage
+*/
+func (rm *RelayMiner) stage(name string, load func()) {
+	start := time.Now()
+	rm.currentStage = &StageResult{Stage: name, Status: StageOk}
+	rm.Probe.Stages = append(rm.Probe.Stages, rm.currentStage)
+	defer func() {
+		observeStage(name, start)
+		rm.currentStage.DurationMs = milliseconds(time.Since(start))
+		rm.logger().Debug("stage finished", "status", rm.currentStage.Status, "duration", time.Since(start))
+		rm.currentStage = nil
+	}()
+	load()
+}
+
+/*
+logger returns the logger of the relay with the relay and the current stage attached
+*/
+func (rm *RelayMiner) logger() *slog.Logger {
+	logger := rm.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With("relay", rm.Relay)
+	if rm.currentStage != nil {
+		logger = logger.With("stage", rm.currentStage.Stage)
+	}
+	return logger
+}
+
+func observeStage(name string, start time.Time) {
+	metrics.StageSeconds.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
+
 func (rm *RelayMiner) Validate() {
+	if rm.exclude(nil) {
+		return
+	}
+	// hidden services are reached through the proxy, they are neither rejected as TOR address nor resolved
+	hidden := IsHiddenService(rm.Relay) && hiddenServiceProxy != nil
 	rm.IsValid, rm.InvalidReason = helper.ValidateURL(rm.Relay)
+	if hidden && validationErrorClass(rm.InvalidReason) == ErrorHiddenService {
+		rm.IsValid, rm.InvalidReason = true, ""
+	}
 	if !rm.IsValid {
-		log.Println(rm.InvalidReason, ": ", rm.Relay)
+		rm.fail(validationErrorClass(rm.InvalidReason), rm.InvalidReason)
+		rm.logger().Info("relay is not valid", "reason", rm.InvalidReason)
 		return
 	}
-	rm.Ips, rm.DnsInValidReason = helper.ValidateDNS(rm.CleanName())
-	if rm.DnsInValidReason != "" {
+	c, err := url.Parse(rm.Relay)
+	if err != nil {
+		rm.IsValid, rm.InvalidReason = false, "Invalid URL"
+		rm.fail(ErrorInvalidURL, err.Error())
+		return
+	}
+	if hidden {
+		return
+	}
+	if rm.DNS == nil {
+		// a relay validated before enqueueing keeps its resolution
+		rm.DNS = dnsResolver.Resolve(c.Hostname())
+	}
+	rm.Ips = rm.DNS.IPs()
+	if rm.DNS.Error != "" {
+		rm.DnsInValidReason = "DNS resolution failed"
 		rm.IsValid = false
 		rm.InvalidReason = rm.DnsInValidReason
-		log.Println(rm.DnsInValidReason, ": ", rm.Relay)
+		rm.fail(dnsErrorClass(rm.DNS.Error), rm.DNS.Detail)
+		rm.logger().Info("relay is not valid", "reason", rm.DnsInValidReason, "dns_error", rm.DNS.Error, "detail", rm.DNS.Detail)
 		return
 	}
-	return
+	rm.exclude(rm.Ips)
+}
+
+/*
+exclude checks the relay against the policy and marks it invalid if a rule excludes it
+*/
+func (rm *RelayMiner) exclude(ips []net.IP) bool {
+	rm.ExcludedBy = rm.Policy.Excluded(rm.Relay, ips)
+	if rm.ExcludedBy == "" {
+		return false
+	}
+	rm.IsValid, rm.InvalidReason = false, "Excluded by policy"
+	rm.fail(ErrorPolicy, rm.ExcludedBy)
+	rm.logger().Info("relay is excluded", "rule", rm.ExcludedBy)
+	return true
 }
 
 /*
@@ -79,40 +198,108 @@ func (rm *RelayMiner) LoadNIP11() {
 		address = fmt.Sprintf("https://%v/", rm.CleanName())
 	}
 	result, err := GetNip11(address)
+	rm.Nip11Validation = ValidateNip11(result)
+	if result != nil {
+		rm.Nip11Timings = result.Timings
+	}
 	if err != nil {
-		log.Printf("error occured: %s\n", err)
+		metrics.HTTPErrors.WithLabelValues(ClassifyError(err)).Inc()
+		rm.fail(ClassifyError(err), err.Error())
+		rm.logger().Warn("fetching the NIP-11 document failed", "url", address, "error", err)
 		return
 	}
-	rm.nip11Result = result
+	// the errors are counted with the classes of the probe result, like the websocket errors
+	switch rm.Nip11Validation.Class {
+	case Nip11ClassHttpError:
+		metrics.HTTPErrors.WithLabelValues(httpErrorClass(result.StatusCode)).Inc()
+		rm.fail(httpErrorClass(result.StatusCode), httpStatusMessage(result.StatusCode))
+	case Nip11ClassHtml, Nip11ClassInvalidJson:
+		metrics.HTTPErrors.WithLabelValues(ErrorInvalidDocument).Inc()
+		rm.fail(ErrorInvalidDocument, "NIP-11 document is "+rm.Nip11Validation.Class)
+	}
+	rm.nip11Result = result.Body
 	rm.parseNip11()
 	return
 }
 
 /*
 parseNip11 internal method to parse the NIP11 document from string
+documents with fields of the wrong type are kept with the fields that could be parsed, anything that is not JSON is dropped
 */
 func (rm *RelayMiner) parseNip11() {
 	byteNip11 := []byte(rm.nip11Result)
 	var nipdoc nip11.RelayInformationDocument
-	_ = json.Unmarshal(byteNip11, &nipdoc)
+	err := json.Unmarshal(byteNip11, &nipdoc)
+	var typeError *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &typeError) {
+		rm.logger().Warn("NIP-11 document is not valid JSON", "error", err)
+		rm.Nip11Document = nil
+		return
+	}
 	rm.Nip11Document = &nipdoc
 
 }
 
+/*
+LoadCertificate captures the TLS certificate of wss relays
+*/
+func (rm *RelayMiner) LoadCertificate() {
+	c, err := url.Parse(rm.Relay)
+	if err != nil || c.Scheme != "wss" || IsHiddenService(rm.Relay) {
+		rm.skipCurrent("no TLS to inspect")
+		return
+	}
+	port := c.Port()
+	if port == "" {
+		port = "443"
+	}
+	rm.Certificate, err = InspectCertificate(c.Hostname(), port, 5*time.Second)
+	if err != nil {
+		rm.CertificateError = err.Error()
+		rm.fail(ClassifyError(err), err.Error())
+		rm.logger().Warn("TLS inspection failed", "error", err)
+	}
+}
+
 /*
 LoadRelayLists Load the NIP-11 Result into the object
 */
 func (rm *RelayMiner) LoadRelayLists() {
 	address := fmt.Sprintf("%v", rm.Relay)
-	result, err := GetRelayList(address)
+	result, err := GetRelayList(address, rm.AuthKey, rm.logger())
+	rm.AuthStatus = result.AuthStatus
+	rm.RelayListTimings = result.Timings
 	if err != nil {
-		log.Printf("error occured: %s\n", err)
+		rm.fail(ClassifyError(err), err.Error())
+		rm.logger().Warn("fetching the relay lists failed", "error", err)
 		return
 	}
-	rm.EventList = result
+	rm.failRelayList(result)
+	rm.EventList = result.Events
+	metrics.EventsFetched.WithLabelValues("relaylist").Add(float64(len(result.Events)))
 	return
 }
 
+/*
+failRelayList records why the relay list request ended without EOSE
+*/
+func (rm *RelayMiner) failRelayList(result *RelayListResult) {
+	switch {
+	case result.AuthStatus == AuthStatusRejected:
+		rm.fail(ErrorAuthRejected, result.Closed)
+	case result.AuthStatus == AuthStatusRequired && len(result.Events) == 0:
+		rm.fail(ErrorAuthRequired, result.Closed)
+	case result.Closed != "":
+		rm.fail(ErrorClosedByRelay, result.Closed)
+	case result.Notice != "":
+		rm.fail(ErrorNotice, result.Notice)
+	case result.ReadError != nil:
+		rm.fail(ClassifyError(result.ReadError), result.ReadError.Error())
+	case result.TimedOut:
+		rm.fail(ErrorTimeout, fmt.Sprintf("no EOSE within %v", relayListTimeout))
+	}
+}
+
 /*
 GetCleanRelayList Get cleaned up list of relays to load the NIP-11 from.
 */
@@ -126,13 +313,46 @@ func (rm *RelayMiner) GetCleanRelayList() []string {
 }
 
 /*
-Software gets the software stack from the NIP 11 document
+Software gets the normalised software stack from the NIP 11 document
 */
 func (rm *RelayMiner) Software() string {
 	if rm.Nip11Document == nil {
 		return "N/A"
 	}
-	return rm.Nip11Document.Software
+	return helper.NormalizeSoftware(rm.Nip11Document.Software)
+}
+
+/*
+SoftwareVersion gets the version of the software stack from the NIP 11 document
+*/
+func (rm *RelayMiner) SoftwareVersion() string {
+	if rm.Nip11Document == nil {
+		return "N/A"
+	}
+	return strings.TrimSpace(rm.Nip11Document.Version)
+}
+
+/*
+Nip11Raw returns the raw NIP 11 response as received from the relay
+*/
+func (rm *RelayMiner) Nip11Raw() string {
+	return string(rm.nip11Result)
+}
+
+/*
+SupportedNips returns the NIP numbers claimed in the NIP 11 document, entries that are no numbers are skipped
+*/
+func (rm *RelayMiner) SupportedNips() []int {
+	nips := make([]int, 0)
+	if rm.Nip11Document == nil {
+		return nips
+	}
+	for _, nip := range rm.Nip11Document.SupportedNIPs {
+		if number, ok := nip.(float64); ok && number == float64(int(number)) {
+			nips = append(nips, int(number))
+		}
+	}
+	return nips
 }
 
 /*
@@ -143,13 +363,14 @@ func (rm *RelayMiner) CleanName() string {
 }
 
 /*
-PublicKey returns the public key of the relay if available
+PublicKey returns the public key of the relay owner as 64 character hex, or an empty string if it is missing or invalid
 */
 func (rm *RelayMiner) PublicKey() string {
 	if rm.Nip11Document == nil {
-		return "N/A"
+		return ""
 	}
-	return rm.Nip11Document.PubKey
+	pubKey, _ := helper.NormalizePubKey(rm.Nip11Document.PubKey)
+	return pubKey
 }
 
 func (rm *RelayMiner) LoadNeighbouringRelays() {
@@ -167,17 +388,36 @@ func (rm *RelayMiner) Stats() {
 	fmt.Printf("Relay: %v\n", rm.Relay)
 	fmt.Printf("\tEvents: %v\n", len(rm.EventList))
 	if rm.Nip11Document != nil {
-		fmt.Printf("\tSoftare: %v\n", rm.Nip11Document.Software)
+		fmt.Printf("\tSoftare: %v\n", rm.Software())
+		fmt.Printf("\tVersion: %v\n", rm.SoftwareVersion())
 		fmt.Printf("\tNIPs: %v\n", rm.Nip11Document.SupportedNIPs)
 	} else {
 		fmt.Printf("\tSoftare: %v\n", "N/A")
 		fmt.Printf("\tNIPs: %v\n", "N/A")
 	}
+	if rm.Nip11Validation != nil {
+		fmt.Printf("\tNIP-11: %v %v\n", rm.Nip11Validation.Class, rm.Nip11Validation.Violations)
+	}
+	if rm.Certificate != nil {
+		fmt.Printf("\tCertificate: %v by %v, valid %v until %v\n", rm.Certificate.Subject, rm.Certificate.Issuer, rm.Certificate.Valid, rm.Certificate.NotAfter)
+	}
+	fmt.Printf("\tAuthentication: %v\n", rm.AuthStatus)
+	for _, verification := range rm.NipVerifications {
+		fmt.Printf("\tNIP-%02d: %v %v\n", verification.Nip, verification.Result, verification.Error)
+	}
+	if rm.KindCensus != nil {
+		fmt.Printf("\tCategory: %v\n", ClassifyRelay(rm.KindCensus))
+	}
 	fmt.Printf("\tNeighbouring Relays: %v\n", len(rm.NeighbourRelays))
+	if rm.Probe != nil {
+		for _, stage := range rm.Probe.Stages {
+			fmt.Printf("\tStage %v: %v %v%v (%.0f ms)\n", stage.Stage, stage.Status, stage.ErrorClass, stage.Reason, stage.DurationMs)
+		}
+	}
 	//fmt.Printf("\tNeighbouring Relys: %v\n", rm.NeighbourRelays)
 
 }
 
 func NewMiner(relayUrl string) *RelayMiner {
-	return &RelayMiner{Relay: relayUrl, EventList: make([]*nostr.Event, 0), loaded: false, DetectedBy: nil}
+	return &RelayMiner{Relay: relayUrl, EventList: make([]*nostr.Event, 0), loaded: false, DetectedBy: nil, AuthStatus: AuthStatusNone}
 }
@@ -0,0 +1,35 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/resolver"
+)
+
+/*
+TestValidate_Resolution tests that a relay resolved before enqueueing is not resolved again
+*/
+func TestValidate_Resolution(t *testing.T) {
+	tests := []struct {
+		name    string
+		dns     *resolver.Resolution
+		want    bool
+		wantIPs int
+	}{
+		{name: "Validate_Resolved", dns: &resolver.Resolution{Host: "relay.invalid", A: []resolver.Record{{Value: "203.0.113.7", TTL: 60}}}, want: true, wantIPs: 1},
+		{name: "Validate_Failed", dns: &resolver.Resolution{Host: "relay.invalid", Error: resolver.ErrorServFail}, want: false, wantIPs: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := NewMiner("wss://relay.invalid")
+			rm.DNS = tt.dns
+			rm.Validate()
+			if rm.IsValid != tt.want || len(rm.Ips) != tt.wantIPs {
+				t.Errorf("Validate() = %v (%v) with %v IPs, want %v with %v IPs", rm.IsValid, rm.InvalidReason, len(rm.Ips), tt.want, tt.wantIPs)
+			}
+			if rm.DNS != tt.dns {
+				t.Errorf("Validate() resolved %v again", rm.Relay)
+			}
+		})
+	}
+}
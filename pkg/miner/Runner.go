@@ -1,10 +1,16 @@
 package miner
 
 import (
-	"log"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+	"github.com/SEG-UNIBE/artio-miner/pkg/metrics"
+	"github.com/SEG-UNIBE/artio-miner/pkg/resolver"
 )
 
 /*
@@ -25,6 +31,8 @@ func (rnr *Runner) handleRelay(relay *RelayMiner) {
 	// load the relay information
 	relay.Load()
 	//relay.Stats()
+	metrics.RelaysProcessed.WithLabelValues(strconv.FormatBool(relay.IsValid), relay.InvalidReason).Inc()
+	defer observeStage("store", time.Now())
 
 	// merge the relay
 	rnr.Neo.Execute(`MERGE(r:Relay {name: $name, isValid: $isValid, validReason: $validReason})`, map[string]any{"name": relay.CleanName(), "validReason": relay.InvalidReason, "isValid": relay.IsValid})
@@ -33,13 +41,37 @@ func (rnr *Runner) handleRelay(relay *RelayMiner) {
 	if relay.DetectedBy != nil {
 		rnr.Neo.Execute(`MATCH(r1:Relay), (r2:Relay) WHERE r1.name=$name1 and r2.name=$name2 MERGE (r1)-[:DETECTED]->(r2);`, map[string]any{"name1": relay.DetectedBy.CleanName(), "name2": relay.CleanName()})
 	}
+	// a relay whose validity changed between crawls has a node per validity, only the current one is seen in this crawl
+	rnr.Neo.Execute(`MATCH(r:Relay), (c:Crawl) WHERE r.name=$name and r.isValid=$isValid and r.validReason=$validReason and c.id=$crawl MERGE (r)-[:SEEN_IN]->(c);`,
+		map[string]any{"name": relay.CleanName(), "isValid": relay.IsValid, "validReason": relay.InvalidReason, "crawl": rnr.CrawlId})
+	// the DNS records and the probe result are kept for invalid relays as well to see why they failed
+	rnr.storeDNS(relay)
+	if relay.ExcludedBy != "" {
+		// excluded only after resolving, e.g. by a network rule
+		rnr.storeExclusion(relay)
+	} else {
+		rnr.storeProbe(relay)
+	}
 	if !relay.IsValid {
 		return
 	}
 
+	// record whether the relay demanded NIP-42 authentication and how it went
+	rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.authStatus=$authStatus, r.network=$network`, map[string]any{"name": relay.CleanName(), "authStatus": relay.AuthStatus, "network": helper.NetworkType(relay.Relay)})
+
 	// do the version
 	rnr.Neo.Execute(`MERGE(s:Software {software: $software})`, map[string]any{"software": relay.Software()})
 
+	// store the remaining NIP-11 information
+	rnr.storeNip11(relay)
+
+	// store the certificate of wss relays
+	rnr.storeCertificate(relay)
+
+	// store the timings of this crawl
+	rnr.storeTimings(relay, "nip11", relay.Nip11Timings)
+	rnr.storeTimings(relay, "relaylist", relay.RelayListTimings)
+
 	// do the nip support
 	if relay.Nip11Document != nil {
 		for _, nip := range relay.Nip11Document.SupportedNIPs {
@@ -47,29 +79,58 @@ func (rnr *Runner) handleRelay(relay *RelayMiner) {
 		}
 	}
 
+	// do the actively verified nip support
+	for _, verification := range relay.NipVerifications {
+		params := map[string]any{"nip": verification.Nip, "name": relay.CleanName(), "result": verification.Result, "error": verification.Error}
+		if verification.Verified() {
+			rnr.Neo.Execute(`MATCH(r:Relay), (n:NIP) WHERE r.name=$name and n.name=$nip MERGE (r)-[v:VERIFIED_IMPLEMENTS]->(n) SET v.result=$result, v.error=$error;`, params)
+		} else {
+			rnr.Neo.Execute(`MATCH(r:Relay), (n:NIP) WHERE r.name=$name and n.name=$nip MERGE (r)-[c:CLAIMS_IMPLEMENTS]->(n) SET c.result=$result, c.error=$error;`, params)
+		}
+	}
+
+	// do the event kind census
+	rnr.storeCensus(relay)
+
 	// merge relation between relay and version
 	rnr.Neo.Execute(`MATCH(r:Relay), (s:Software) WHERE r.name=$name and s.software=$version MERGE (r)-[:USES_SOFTWARE]->(s);`, map[string]any{"version": relay.Software(), "name": relay.CleanName()})
+	rnr.storeSoftwareVersion(relay)
+	// the relay node is shared by all crawls, keep the software and version seen in this crawl on its edge
+	version := relay.SoftwareVersion()
+	if version == "N/A" {
+		version = ""
+	}
+	rnr.Neo.Execute(`MATCH(r:Relay)-[s:SEEN_IN]->(c:Crawl) WHERE r.name=$name and r.isValid=true and c.id=$crawl SET s.software=$software, s.version=$version`, map[string]any{"name": relay.CleanName(), "crawl": rnr.CrawlId, "software": relay.Software(), "version": version})
 
-	// merge the public key of the owner
-	rnr.Neo.Execute(`MERGE(u:User {pubkey: $pubkey})`, map[string]any{"pubkey": relay.PublicKey()})
+	// merge the public key of the owner, relays without a valid pubkey get no owner
+	if relay.Nip11Document != nil && relay.Nip11Document.PubKey != "" {
+		rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.claimedPubkey=$claimed, r.pubkeyValid=$valid`, map[string]any{"name": relay.CleanName(), "claimed": relay.Nip11Document.PubKey, "valid": relay.PublicKey() != ""})
+	}
+	if relay.PublicKey() != "" {
+		rnr.Neo.Execute(`MERGE(u:User {pubkey: $pubkey})`, map[string]any{"pubkey": relay.PublicKey()})
 
-	// merge relation between relay and owner
-	rnr.Neo.Execute(`MATCH(r:Relay), (u:User) WHERE r.name=$name and u.pubkey=$pubkey MERGE (u)-[:OWNS]->(r);`, map[string]any{"pubkey": relay.PublicKey(), "name": relay.CleanName()})
+		// merge relation between relay and owner
+		rnr.Neo.Execute(`MATCH(r:Relay), (u:User) WHERE r.name=$name and u.pubkey=$pubkey MERGE (u)-[:OWNS]->(r);`, map[string]any{"pubkey": relay.PublicKey(), "name": relay.CleanName()})
+		if rnr.EnrichOperators {
+			rnr.collectOperator(relay.PublicKey(), relay.Relay)
+		}
+	}
 
-	// do the IP addresses
+	// locate and reverse resolve the IP addresses, the addresses themselves are stored with the DNS records
 	for _, ip := range relay.Ips {
-		rnr.Neo.Execute(`MERGE(i:IP {address: $address})`, map[string]any{"address": ip.String()})
-		rnr.Neo.Execute(`MATCH(r:Relay), (i:IP) WHERE r.name=$name and i.address=$address MERGE (r)-[:HAS_IP]->(i);`, map[string]any{"address": ip.String(), "name": relay.CleanName()})
+		rnr.storeLocation(ip)
+		rnr.storeReverse(ip)
 	}
 
 	if relay.RecursionLevel > 0 {
-		log.Printf("Runner %d: Found %d new Relays for possible mining on %s\n", rnr.Id, len(relay.NeighbourRelays), relay.Relay)
+		relay.logger().Info("found neighbouring relays", "relays", len(relay.NeighbourRelays))
 		for _, rel := range relay.NeighbourRelays {
 			// create the new RelayMiner object and enqueue it for further processing
 
-			newRelay := NewMiner(rel)
+			newRelay := rnr.NewMiner(rel)
 			newRelay.DetectedBy = relay
 			newRelay.RecursionLevel = relay.RecursionLevel - 1
+			newRelay.Logger = rnr.logger()
 			newRelay.Validate()
 			rnr.Neo.Execute(`MERGE(r:Relay {name: $name, isValid: $isValid, validReason: $validReason})`, map[string]any{"name": newRelay.CleanName(), "validReason": newRelay.InvalidReason, "isValid": newRelay.IsValid})
 			// rnr.Neo.Execute(`MERGE(r:Relay {name: $name})`, map[string]any{"name": newRelay.CleanName()})
@@ -80,8 +141,11 @@ func (rnr *Runner) handleRelay(relay *RelayMiner) {
 
 			rnr.Enqueue(newRelay)
 		}
+		if rnr.EnrichUsers {
+			rnr.collectUsers(relay.EventList)
+		}
 		if rnr.PushUsers {
-			log.Printf("Runner %d: Found %d new NIP-65 messages\n", rnr.Id, len(relay.EventList))
+			relay.logger().Info("found NIP-65 relay lists", "events", len(relay.EventList))
 			for _, evt := range relay.EventList {
 				rnr.Neo.Execute(`MERGE(u:User {pubkey: $pubkey})`, map[string]any{"pubkey": evt.PubKey})
 
@@ -94,31 +158,256 @@ func (rnr *Runner) handleRelay(relay *RelayMiner) {
 	}
 }
 
+/*
+storeNip11 stores the full NIP-11 document of the relay as properties and nodes, together with the raw response
+*/
+func (rnr *Runner) storeNip11(relay *RelayMiner) {
+	name := relay.CleanName()
+	rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.nip11Raw=$raw`, map[string]any{"name": name, "raw": relay.Nip11Raw()})
+	if validation := relay.Nip11Validation; validation != nil {
+		rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.nip11Class=$class, r.nip11Compliant=$compliant, r.nip11Status=$status, r.nip11ContentType=$contentType, r.nip11ContentTypeValid=$contentTypeValid, r.nip11Cors=$cors, r.nip11JsonValid=$jsonValid, r.nip11Violations=$violations`, map[string]any{
+			"name": name, "class": validation.Class, "compliant": validation.Compliant(), "status": validation.HttpStatus, "contentType": validation.ContentType,
+			"contentTypeValid": validation.ContentTypeValid, "cors": validation.Cors, "jsonValid": validation.JsonValid, "violations": validation.Violations,
+		})
+	}
+	doc := relay.Nip11Document
+	if doc == nil {
+		return
+	}
+	rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.nip11Name=$nip11Name, r.description=$description, r.contact=$contact, r.version=$version, r.icon=$icon, r.banner=$banner, r.postingPolicy=$postingPolicy, r.paymentsUrl=$paymentsUrl`, map[string]any{
+		"name": name, "nip11Name": doc.Name, "description": doc.Description, "contact": doc.Contact, "version": doc.Version,
+		"icon": doc.Icon, "banner": doc.Banner, "postingPolicy": doc.PostingPolicy, "paymentsUrl": doc.PaymentsURL,
+	})
+
+	if limitation := doc.Limitation; limitation != nil {
+		rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.maxMessageLength=$maxMessageLength, r.maxSubscriptions=$maxSubscriptions, r.maxLimit=$maxLimit, r.defaultLimit=$defaultLimit, r.maxSubidLength=$maxSubidLength, r.maxEventTags=$maxEventTags, r.maxContentLength=$maxContentLength, r.minPowDifficulty=$minPowDifficulty, r.createdAtLowerLimit=$createdAtLowerLimit, r.createdAtUpperLimit=$createdAtUpperLimit, r.authRequired=$authRequired, r.paymentRequired=$paymentRequired, r.restrictedWrites=$restrictedWrites`, map[string]any{
+			"name": name, "maxMessageLength": limitation.MaxMessageLength, "maxSubscriptions": limitation.MaxSubscriptions,
+			"maxLimit": limitation.MaxLimit, "defaultLimit": limitation.DefaultLimit, "maxSubidLength": limitation.MaxSubidLength,
+			"maxEventTags": limitation.MaxEventTags, "maxContentLength": limitation.MaxContentLength, "minPowDifficulty": limitation.MinPowDifficulty,
+			"createdAtLowerLimit": limitation.CreatedAtLowerLimit, "createdAtUpperLimit": limitation.CreatedAtUpperLimit,
+			"authRequired": limitation.AuthRequired, "paymentRequired": limitation.PaymentRequired, "restrictedWrites": limitation.RestrictedWrites,
+		})
+	}
+
+	for _, country := range doc.RelayCountries {
+		rnr.Neo.Execute(`MERGE(c:Country {code: $code})`, map[string]any{"code": strings.ToUpper(country)})
+		rnr.Neo.Execute(`MATCH(r:Relay), (c:Country) WHERE r.name=$name and c.code=$code MERGE (r)-[:OPERATES_IN]->(c);`, map[string]any{"name": name, "code": strings.ToUpper(country)})
+	}
+	for _, language := range doc.LanguageTags {
+		rnr.Neo.Execute(`MERGE(l:Language {tag: $tag})`, map[string]any{"tag": language})
+		rnr.Neo.Execute(`MATCH(r:Relay), (l:Language) WHERE r.name=$name and l.tag=$tag MERGE (r)-[:USES_LANGUAGE]->(l);`, map[string]any{"name": name, "tag": language})
+	}
+	for _, tag := range doc.Tags {
+		rnr.Neo.Execute(`MERGE(t:RelayTag {name: $tag})`, map[string]any{"tag": tag})
+		rnr.Neo.Execute(`MATCH(r:Relay), (t:RelayTag) WHERE r.name=$name and t.name=$tag MERGE (r)-[:HAS_TAG]->(t);`, map[string]any{"name": name, "tag": tag})
+	}
+
+	for i, retention := range doc.Retention {
+		if retention == nil {
+			continue
+		}
+		kinds, _ := json.Marshal(retention.Kinds)
+		rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name MERGE (r)-[:HAS_RETENTION]->(rt:Retention {relay: $name, index: $index}) SET rt.time=$time, rt.count=$count, rt.kinds=$kinds`, map[string]any{
+			"name": name, "index": i, "time": retention.Time, "count": retention.Count, "kinds": string(kinds),
+		})
+	}
+
+	if fees := doc.Fees; fees != nil {
+		for _, fee := range fees.Admission {
+			rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name MERGE (r)-[:CHARGES]->(f:Fee {relay: $name, type: "admission", amount: $amount, unit: $unit})`, map[string]any{"name": name, "amount": fee.Amount, "unit": fee.Unit})
+		}
+		for _, fee := range fees.Subscription {
+			rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name MERGE (r)-[:CHARGES]->(f:Fee {relay: $name, type: "subscription", amount: $amount, unit: $unit, period: $period})`, map[string]any{"name": name, "amount": fee.Amount, "unit": fee.Unit, "period": fee.Period})
+		}
+		for _, fee := range fees.Publication {
+			rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name MERGE (r)-[:CHARGES]->(f:Fee {relay: $name, type: "publication", amount: $amount, unit: $unit, kinds: $kinds})`, map[string]any{"name": name, "amount": fee.Amount, "unit": fee.Unit, "kinds": fee.Kinds})
+		}
+	}
+}
+
+/*
+storeSoftwareVersion stores the version of the relay software as SoftwareVersion node linked to its Software
+*/
+func (rnr *Runner) storeSoftwareVersion(relay *RelayMiner) {
+	version := relay.SoftwareVersion()
+	if version == "" || version == "N/A" {
+		return
+	}
+	semver, isSemver := helper.ParseSemver(version)
+	params := map[string]any{
+		"name": relay.CleanName(), "software": relay.Software(), "version": version, "isSemver": isSemver,
+		"major": semver.Major, "minor": semver.Minor, "patch": semver.Patch, "prerelease": semver.Prerelease,
+	}
+	rnr.Neo.Execute(`MERGE(v:SoftwareVersion {software: $software, version: $version}) SET v.isSemver=$isSemver, v.major=$major, v.minor=$minor, v.patch=$patch, v.prerelease=$prerelease`, params)
+	rnr.Neo.Execute(`MATCH(v:SoftwareVersion), (s:Software) WHERE v.software=$software and v.version=$version and s.software=$software MERGE (v)-[:VERSION_OF]->(s);`, params)
+	rnr.Neo.Execute(`MATCH(r:Relay), (v:SoftwareVersion) WHERE r.name=$name and v.software=$software and v.version=$version MERGE (r)-[:USES_VERSION]->(v);`, params)
+}
+
+/*
+storeDNS stores the resolved addresses with their record type and TTL, the CNAME chain and the name servers of the relay
+*/
+func (rnr *Runner) storeDNS(relay *RelayMiner) {
+	if relay.DNS == nil {
+		return
+	}
+	name := relay.CleanName()
+	rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.dnsError=$error, r.dnsErrorDetail=$detail, r.dnsServer=$server`, map[string]any{"name": name, "error": relay.DNS.Error, "detail": relay.DNS.Detail, "server": relay.DNS.Server})
+	for recordType, records := range map[string][]resolver.Record{"A": relay.DNS.A, "AAAA": relay.DNS.AAAA} {
+		for _, record := range records {
+			params := map[string]any{"name": name, "address": record.Value, "type": recordType, "ttl": int64(record.TTL)}
+			rnr.Neo.Execute(`MERGE(i:IP {address: $address})`, params)
+			rnr.Neo.Execute(`MATCH(r:Relay), (i:IP) WHERE r.name=$name and i.address=$address MERGE (r)-[h:HAS_IP]->(i) SET h.type=$type, h.ttl=$ttl;`, params)
+		}
+	}
+	for position, record := range relay.DNS.CNAMEs {
+		params := map[string]any{"name": name, "target": record.Value, "position": position, "ttl": int64(record.TTL)}
+		rnr.Neo.Execute(`MERGE(c:CNAME {name: $target})`, params)
+		rnr.Neo.Execute(`MATCH(r:Relay), (c:CNAME) WHERE r.name=$name and c.name=$target MERGE (r)-[a:ALIAS_OF]->(c) SET a.position=$position, a.ttl=$ttl;`, params)
+	}
+	for _, record := range relay.DNS.NS {
+		params := map[string]any{"name": name, "server": record.Value, "ttl": int64(record.TTL)}
+		rnr.Neo.Execute(`MERGE(n:NameServer {name: $server})`, params)
+		rnr.Neo.Execute(`MATCH(r:Relay), (n:NameServer) WHERE r.name=$name and n.name=$server MERGE (r)-[s:SERVED_BY]->(n) SET s.ttl=$ttl;`, params)
+	}
+}
+
+/*
+storeLocation attaches the country, city and autonomous system of the GeoIP databases to the IP node
+*/
+func (rnr *Runner) storeLocation(ip net.IP) {
+	if rnr.GeoIP == nil {
+		return
+	}
+	location, err := rnr.GeoIP.Lookup(ip)
+	if err != nil {
+		rnr.logger().Warn("GeoIP lookup failed", "ip", ip.String(), "error", err)
+		return
+	}
+	params := map[string]any{
+		"address": ip.String(), "code": location.CountryCode, "country": location.CountryName, "city": location.City,
+		"asn": int64(location.ASN), "organisation": location.Organisation,
+	}
+	rnr.Neo.Execute(`MATCH(i:IP) WHERE i.address=$address SET i.country=$code, i.city=$city, i.asn=$asn, i.organisation=$organisation`, params)
+	if location.CountryCode != "" {
+		rnr.Neo.Execute(`MERGE(c:Country {code: $code}) SET c.name=$country`, params)
+		rnr.Neo.Execute(`MATCH(i:IP), (c:Country) WHERE i.address=$address and c.code=$code MERGE (i)-[:LOCATED_IN]->(c);`, params)
+	}
+	if location.ASN != 0 {
+		rnr.Neo.Execute(`MERGE(a:ASN {number: $asn}) SET a.organisation=$organisation`, params)
+		rnr.Neo.Execute(`MATCH(i:IP), (a:ASN) WHERE i.address=$address and a.number=$asn MERGE (i)-[:ANNOUNCED_BY]->(a);`, params)
+	}
+}
+
+/*
+publishRelay publishes the NIP-66 discovery event for a valid relay if a publisher is configured
+*/
+func (rnr *Runner) publishRelay(relay *RelayMiner) {
+	if rnr.Publisher == nil || !relay.IsValid {
+		return
+	}
+	if err := rnr.Publisher.PublishRelay(relay); err != nil {
+		relay.logger().Warn("publishing the NIP-66 event failed", "error", err)
+	}
+}
+
+/*
+storeTimings stores the measured phases of a request to the relay as Timing node of the current crawl
+*/
+func (rnr *Runner) storeTimings(relay *RelayMiner, stage string, timings *Timings) {
+	if timings == nil {
+		return
+	}
+	params := timings.Milliseconds()
+	params["name"] = relay.CleanName()
+	params["crawl"] = rnr.CrawlId
+	params["stage"] = stage
+	rnr.Neo.Execute(`MATCH(r:Relay), (c:Crawl) WHERE r.name=$name and c.id=$crawl
+		MERGE (t:Timing {relay: $name, crawl: $crawl, stage: $stage})
+		SET t.dnsMs=$dnsMs, t.connectMs=$connectMs, t.tlsMs=$tlsMs, t.firstByteMs=$firstByteMs, t.upgradeMs=$upgradeMs, t.firstEventMs=$firstEventMs, t.eoseMs=$eoseMs
+		MERGE (r)-[:MEASURED]->(t)
+		MERGE (t)-[:IN_CRAWL]->(c);`, params)
+}
+
+/*
+storeCertificate stores the presented TLS certificate on the relay and links its issuer
+*/
+func (rnr *Runner) storeCertificate(relay *RelayMiner) {
+	cert := relay.Certificate
+	if cert == nil {
+		if relay.CertificateError != "" {
+			rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.certValid=false, r.certError=$error`, map[string]any{"name": relay.CleanName(), "error": relay.CertificateError})
+		}
+		return
+	}
+	params := map[string]any{
+		"name": relay.CleanName(), "subject": cert.Subject, "sans": cert.SANs, "issuer": cert.Issuer, "organization": cert.IssuerOrganization,
+		"notBefore": cert.NotBefore.Unix(), "notAfter": cert.NotAfter.Unix(), "keyType": cert.KeyType, "chain": cert.Chain,
+		"valid": cert.Valid, "error": cert.ValidationError, "expired": cert.Expired(time.Now()), "tlsVersion": cert.TLSVersion, "cipher": cert.CipherSuite,
+	}
+	rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.certSubject=$subject, r.certSans=$sans, r.certIssuer=$issuer, r.certNotBefore=$notBefore, r.certNotAfter=$notAfter, r.certKeyType=$keyType, r.certChain=$chain, r.certValid=$valid, r.certError=$error, r.certExpired=$expired, r.tlsVersion=$tlsVersion, r.tlsCipher=$cipher`, params)
+	rnr.Neo.Execute(`MERGE(ci:CertificateIssuer {name: $issuer}) SET ci.organization=$organization`, params)
+	rnr.Neo.Execute(`MATCH(r:Relay), (ci:CertificateIssuer) WHERE r.name=$name and ci.name=$issuer MERGE (r)-[:CERT_ISSUED_BY]->(ci);`, params)
+}
+
+/*
+storeCensus stores the estimated event counts per kind and bucket and the resulting category of the relay
+*/
+func (rnr *Runner) storeCensus(relay *RelayMiner) {
+	if relay.KindCensus == nil {
+		return
+	}
+	for _, count := range relay.KindCensus {
+		params := map[string]any{"name": relay.CleanName(), "kind": count.Kind, "bucket": count.Bucket, "count": count.Count, "method": count.Method, "capped": count.Capped}
+		rnr.Neo.Execute(`MERGE(k:Kind {number: $kind})`, params)
+		rnr.Neo.Execute(`MATCH(r:Relay), (k:Kind) WHERE r.name=$name and k.number=$kind MERGE (r)-[h:HOSTS_KIND {bucket: $bucket}]->(k) SET h.count=$count, h.method=$method, h.capped=$capped;`, params)
+	}
+	rnr.Neo.Execute(`MATCH(r:Relay) WHERE r.name=$name SET r.category=$category`, map[string]any{"name": relay.CleanName(), "category": ClassifyRelay(relay.KindCensus)})
+}
+
 func (rnr *Runner) Run() {
 	rnr.running = true
-	log.Printf("Runner %d started\n", rnr.Id)
+	rnr.logger().Debug("runner started")
+	state := metrics.NewRunnerState()
+	defer state.Done()
 	for rnr.running {
 		nextMiner := rnr.Dequeue()
 		if nextMiner == nil {
 			if !rnr.idle {
-				log.Printf("Runner %d is idle\n", rnr.Id)
+				rnr.logger().Debug("runner is idle")
 			}
+			state.Set("idle")
 			rnr.idle = true
 
 			time.Sleep(time.Second)
 			continue
 		} else {
 			if rnr.idle {
-				log.Printf("Runner %d is running\n", rnr.Id)
+				rnr.logger().Debug("runner is running")
 			}
 			rnr.idle = false
-			log.Printf("Runner %d is running with Relay %s\n", rnr.Id, nextMiner.Relay)
+			state.Set("busy")
+			rnr.throttle()
+			nextMiner.Logger = rnr.logger()
+			nextMiner.logger().Debug("mining relay")
+			start := time.Now()
+			rnr.progress.working(rnr.Id, nextMiner.Relay)
 			rnr.handleRelay(nextMiner)
+			rnr.publishRelay(nextMiner)
+			rnr.progress.finished(nextMiner, time.Since(start))
+			nextMiner.logger().Info("relay mined", "valid", nextMiner.IsValid, "reason", nextMiner.InvalidReason, "duration", time.Since(start))
+			rnr.progress.working(rnr.Id, "")
 		}
 
 	}
 }
 
+/*
+logger returns the logger of the crawl with the runner attached
+*/
+func (rnr *Runner) logger() *slog.Logger {
+	return rnr.Manager.logger().With("runner", rnr.Id)
+}
+
 func (rnr *Runner) SignalEnd() {
 	rnr.running = false
 }
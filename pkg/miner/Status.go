@@ -0,0 +1,187 @@
+package miner
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+CrawlStatus is a snapshot of the progress of a crawl
+*/
+type CrawlStatus struct {
+	CrawlId    string         `json:"crawlId"`
+	Running    bool           `json:"running"`
+	StartedAt  time.Time      `json:"startedAt"`
+	ElapsedSec float64        `json:"elapsedSec"`
+	EtaSec     float64        `json:"etaSec"` // estimate from the average rate and the current frontier, -1 if unknown
+	Frontier   int            `json:"frontier"`
+	Visited    int            `json:"visited"`
+	Valid      int            `json:"valid"`
+	Invalid    int            `json:"invalid"`
+	Runners    []RunnerStatus `json:"runners"`
+	Reasons    map[string]int `json:"reasons"` // number of invalid relays per reason
+}
+
+/*
+RunnerStatus holds what a runner is working on
+*/
+type RunnerStatus struct {
+	Id         int     `json:"id"`
+	Relay      string  `json:"relay"` // empty if idle
+	ElapsedSec float64 `json:"elapsedSec"`
+}
+
+/*
+RelayResult holds the outcome of mining a relay
+*/
+type RelayResult struct {
+	Relay         string    `json:"relay"`
+	Valid         bool      `json:"valid"`
+	InvalidReason string    `json:"invalidReason,omitempty"`
+	ErrorClass    string    `json:"errorClass,omitempty"`
+	Software      string    `json:"software,omitempty"`
+	Version       string    `json:"version,omitempty"`
+	Nip11Class    string    `json:"nip11Class,omitempty"`
+	AuthStatus    string    `json:"authStatus,omitempty"`
+	Neighbours    int       `json:"neighbours"`
+	DurationMs    float64   `json:"durationMs"`
+	FinishedAt    time.Time `json:"finishedAt"`
+}
+
+/*
+crawlProgress tracks the progress of a crawl for the status API, safe for concurrent use
+*/
+type crawlProgress struct {
+	mutex     sync.RWMutex
+	crawlId   string
+	startedAt time.Time
+	running   bool
+	queue     *Queue
+	current   map[int]RunnerStatus
+	started   map[int]time.Time
+	results   map[string]*RelayResult
+}
+
+func (p *crawlProgress) start(crawlId string, queue *Queue, runners int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.crawlId, p.startedAt, p.running, p.queue = crawlId, time.Now(), true, queue
+	p.current = make(map[int]RunnerStatus, runners)
+	p.started = make(map[int]time.Time, runners)
+	p.results = make(map[string]*RelayResult)
+	for i := range runners {
+		p.current[i] = RunnerStatus{Id: i}
+	}
+}
+
+func (p *crawlProgress) stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.running = false
+}
+
+/*
+working marks the relay a runner started, an empty relay marks it idle
+*/
+func (p *crawlProgress) working(runner int, relay string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.current == nil {
+		return
+	}
+	p.current[runner] = RunnerStatus{Id: runner, Relay: relay}
+	p.started[runner] = time.Now()
+}
+
+/*
+finished records the result of a relay
+*/
+func (p *crawlProgress) finished(relay *RelayMiner, duration time.Duration) {
+	result := &RelayResult{
+		Relay: relay.CleanName(), Valid: relay.IsValid, InvalidReason: relay.InvalidReason, AuthStatus: relay.AuthStatus,
+		Neighbours: len(relay.NeighbourRelays), DurationMs: milliseconds(duration), FinishedAt: time.Now(),
+	}
+	if relay.Nip11Document != nil {
+		result.Software, result.Version = relay.Software(), relay.SoftwareVersion()
+	}
+	if relay.Probe != nil {
+		result.ErrorClass = relay.Probe.ErrorClass
+	}
+	if relay.Nip11Validation != nil {
+		result.Nip11Class = relay.Nip11Validation.Class
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.results != nil {
+		p.results[result.Relay] = result
+	}
+}
+
+/*
+Status returns a snapshot of the progress of the crawl
+*/
+func (mgmt *Manager) Status() CrawlStatus {
+	p := &mgmt.progress
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	frontier := 0
+	if p.queue != nil {
+		frontier = p.queue.Length()
+	}
+	status := CrawlStatus{CrawlId: p.crawlId, Running: p.running, StartedAt: p.startedAt, Frontier: frontier, EtaSec: -1, Runners: make([]RunnerStatus, 0, len(p.current)), Reasons: make(map[string]int)}
+	if p.startedAt.IsZero() {
+		return status
+	}
+	status.ElapsedSec = time.Since(p.startedAt).Seconds()
+	for _, result := range p.results {
+		if result.Valid {
+			status.Valid++
+		} else {
+			status.Invalid++
+			status.Reasons[result.InvalidReason]++
+		}
+	}
+	status.Visited = len(p.results)
+	for id, runner := range p.current {
+		if runner.Relay != "" {
+			runner.ElapsedSec = time.Since(p.started[id]).Seconds()
+		}
+		status.Runners = append(status.Runners, runner)
+	}
+	slices.SortFunc(status.Runners, func(a, b RunnerStatus) int { return a.Id - b.Id })
+	if status.Visited > 0 && p.running {
+		status.EtaSec = status.ElapsedSec / float64(status.Visited) * float64(frontier)
+	}
+	return status
+}
+
+/*
+Results returns the results of the relays mined so far ordered by name
+*/
+func (mgmt *Manager) Results() []RelayResult {
+	p := &mgmt.progress
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	results := make([]RelayResult, 0, len(p.results))
+	for _, result := range p.results {
+		results = append(results, *result)
+	}
+	slices.SortFunc(results, func(a, b RelayResult) int { return strings.Compare(a.Relay, b.Relay) })
+	return results
+}
+
+/*
+Result returns the result of a single relay by its cleaned name
+*/
+func (mgmt *Manager) Result(name string) (RelayResult, bool) {
+	p := &mgmt.progress
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	result, ok := p.results[name]
+	if !ok {
+		return RelayResult{}, false
+	}
+	return *result, true
+}
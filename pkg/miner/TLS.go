@@ -0,0 +1,117 @@
+package miner
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+/*
+CertificateInfo holds the certificate chain and connection parameters presented by a wss relay
+*/
+type CertificateInfo struct {
+	Subject            string
+	SANs               []string
+	Issuer             string
+	IssuerOrganization string
+	NotBefore          time.Time
+	NotAfter           time.Time
+	KeyType            string
+	Chain              []string // subjects of the presented chain, leaf first
+	Valid              bool     // validates against the system roots for the hostname
+	ValidationError    string
+	TLSVersion         string
+	CipherSuite        string
+}
+
+/*
+Expired returns true if the leaf certificate is outside of its validity window
+*/
+func (ci *CertificateInfo) Expired(now time.Time) bool {
+	return now.Before(ci.NotBefore) || now.After(ci.NotAfter)
+}
+
+/*
+InspectCertificate connects to the host and captures the presented certificate chain
+the handshake does not verify the chain, the validation against the system roots is recorded instead
+*/
+func InspectCertificate(host string, port string, timeout time.Duration) (*CertificateInfo, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return DescribeConnection(host, conn.ConnectionState())
+}
+
+/*
+DescribeConnection extracts the CertificateInfo from an established TLS connection to the host
+*/
+func DescribeConnection(host string, state tls.ConnectionState) (*CertificateInfo, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("no certificate presented")
+	}
+	leaf := state.PeerCertificates[0]
+	info := &CertificateInfo{
+		Subject:     leaf.Subject.CommonName,
+		SANs:        slices.Concat(leaf.DNSNames, ipStrings(leaf.IPAddresses)),
+		Issuer:      leaf.Issuer.CommonName,
+		NotBefore:   leaf.NotBefore,
+		NotAfter:    leaf.NotAfter,
+		KeyType:     keyType(leaf),
+		Chain:       make([]string, 0, len(state.PeerCertificates)),
+		TLSVersion:  tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if info.Issuer == "" {
+		info.Issuer = leaf.Issuer.String()
+	}
+	if len(leaf.Issuer.Organization) > 0 {
+		info.IssuerOrganization = strings.Join(leaf.Issuer.Organization, ", ")
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, cert.Subject.String())
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates})
+	info.Valid = err == nil
+	if err != nil {
+		info.ValidationError = err.Error()
+	}
+	return info, nil
+}
+
+/*
+keyType describes the public key algorithm and size of a certificate
+*/
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA-%s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+func ipStrings(ips []net.IP) []string {
+	result := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+	return result
+}
@@ -0,0 +1,34 @@
+package miner
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+/*
+TestInspectCertificate tests capturing the certificate of a TLS server that is not trusted by the system roots
+*/
+func TestInspectCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	address, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(address.Host)
+
+	info, err := InspectCertificate(host, port, time.Second)
+	if err != nil {
+		t.Fatalf("InspectCertificate() error = %v", err)
+	}
+	if info.Valid || info.ValidationError == "" {
+		t.Errorf("InspectCertificate() valid = %v, want invalid for a self-signed certificate", info.Valid)
+	}
+	if info.KeyType == "" || info.TLSVersion == "" || info.CipherSuite == "" || len(info.Chain) == 0 {
+		t.Errorf("InspectCertificate() = %+v, missing connection details", info)
+	}
+	if info.Expired(time.Now()) {
+		t.Errorf("InspectCertificate() expired, want the certificate to be within its validity window")
+	}
+}
@@ -0,0 +1,112 @@
+package miner
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+/*
+Timings holds the durations of the phases of a single request to a relay
+phases that were not reached are -1
+*/
+type Timings struct {
+	DNS        time.Duration
+	Connect    time.Duration
+	TLS        time.Duration
+	FirstByte  time.Duration // since the start, until the first byte of the HTTP or upgrade response
+	Upgrade    time.Duration // since the start, until the websocket connection is established
+	FirstEvent time.Duration // since the REQ, until the first EVENT
+	EOSE       time.Duration // since the REQ, until the EOSE
+	start      time.Time
+	mutex      sync.Mutex
+}
+
+/*
+NewTimings creates Timings with all phases unreached, starting now
+*/
+func NewTimings() *Timings {
+	return &Timings{DNS: -1, Connect: -1, TLS: -1, FirstByte: -1, Upgrade: -1, FirstEvent: -1, EOSE: -1, start: time.Now()}
+}
+
+/*
+WithTrace returns a context that records the DNS, connect, TLS and first byte phases into the timings
+*/
+func (t *Timings) WithTrace(ctx context.Context) context.Context {
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.DNS = time.Since(dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			connectStart = time.Now()
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			if err == nil {
+				t.Connect = time.Since(connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			if err == nil {
+				t.TLS = time.Since(tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.FirstByte = time.Since(t.start)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
+
+/*
+Mark sets a phase to the time passed since from, a phase is only set once
+*/
+func (t *Timings) Mark(phase *time.Duration, from time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if *phase < 0 {
+		*phase = time.Since(from)
+	}
+}
+
+/*
+Milliseconds returns the phases as milliseconds for storing, unreached phases stay -1
+*/
+func (t *Timings) Milliseconds() map[string]any {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	result := make(map[string]any)
+	for name, duration := range map[string]time.Duration{
+		"dnsMs": t.DNS, "connectMs": t.Connect, "tlsMs": t.TLS, "firstByteMs": t.FirstByte,
+		"upgradeMs": t.Upgrade, "firstEventMs": t.FirstEvent, "eoseMs": t.EOSE,
+	} {
+		if duration < 0 {
+			result[name] = float64(-1)
+		} else {
+			result[name] = float64(duration.Microseconds()) / 1000
+		}
+	}
+	return result
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+/*
+Kinds of rules
+*/
+const (
+	RuleHost     = "host"     // exact host, e.g. relay.example.com
+	RuleWildcard = "wildcard" // subdomains of a domain, e.g. *.example.com
+	RuleCIDR     = "cidr"     // addresses of the relay in a network, e.g. 10.0.0.0/8
+	RuleRegex    = "regex"    // regular expression on the relay URL, e.g. regex:^ws://
+)
+
+/*
+Rule is a single allow or deny pattern
+*/
+type Rule struct {
+	Pattern string
+	Kind    string
+	host    string
+	network *net.IPNet
+	regex   *regexp.Regexp
+}
+
+/*
+ParseRule parses a pattern, regular expressions are prefixed with regex:, networks are given in CIDR notation
+*/
+func ParseRule(pattern string) (*Rule, error) {
+	pattern = strings.TrimSpace(pattern)
+	rule := &Rule{Pattern: pattern}
+	switch {
+	case pattern == "":
+		return nil, errors.New("empty rule")
+	case strings.HasPrefix(pattern, "regex:"):
+		regex, err := regexp.Compile(strings.TrimPrefix(pattern, "regex:"))
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", pattern, err)
+		}
+		rule.Kind, rule.regex = RuleRegex, regex
+	case strings.Contains(pattern, "/"):
+		_, network, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", pattern, err)
+		}
+		rule.Kind, rule.network = RuleCIDR, network
+	case strings.HasPrefix(pattern, "*."):
+		rule.Kind, rule.host = RuleWildcard, strings.ToLower(strings.TrimPrefix(pattern, "*"))
+	default:
+		rule.Kind, rule.host = RuleHost, strings.ToLower(pattern)
+	}
+	return rule, nil
+}
+
+/*
+match checks the rule against a relay, decided is false for network rules while the addresses of a host are unknown
+*/
+func (r *Rule) match(relay string, host string, ips []net.IP) (matched bool, decided bool) {
+	switch r.Kind {
+	case RuleRegex:
+		return r.regex.MatchString(relay), true
+	case RuleCIDR:
+		if ip := net.ParseIP(host); ip != nil {
+			return r.network.Contains(ip), true
+		}
+		for _, ip := range ips {
+			if r.network.Contains(ip) {
+				return true, true
+			}
+		}
+		return false, ips != nil
+	case RuleWildcard:
+		return strings.HasSuffix(host, r.host), true
+	default:
+		return host == r.host, true
+	}
+}
+
+/*
+Policy decides which relays may be crawled, deny rules win over allow rules
+without allow rules every relay not denied is allowed
+*/
+type Policy struct {
+	Allow []*Rule
+	Deny  []*Rule
+}
+
+/*
+New parses the allow and deny patterns, all invalid patterns are reported together
+*/
+func New(allow []string, deny []string) (*Policy, error) {
+	policy := &Policy{Allow: make([]*Rule, 0, len(allow)), Deny: make([]*Rule, 0, len(deny))}
+	var errs []error
+	for _, pattern := range allow {
+		rule, err := ParseRule(pattern)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		policy.Allow = append(policy.Allow, rule)
+	}
+	for _, pattern := range deny {
+		rule, err := ParseRule(pattern)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		policy.Deny = append(policy.Deny, rule)
+	}
+	return policy, errors.Join(errs...)
+}
+
+/*
+Excluded returns the rule excluding the relay, e.g. "deny *.example.com", or an empty string if it may be crawled
+ips are the resolved addresses of the relay, nil if not resolved yet, network rules are then only applied to IP hosts
+*/
+func (p *Policy) Excluded(relay string, ips []net.IP) string {
+	if p == nil {
+		return ""
+	}
+	host := relay
+	if u, err := url.Parse(relay); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, rule := range p.Deny {
+		if matched, _ := rule.match(relay, host, ips); matched {
+			return "deny " + rule.Pattern
+		}
+	}
+	if len(p.Allow) == 0 {
+		return ""
+	}
+	undecided := false
+	for _, rule := range p.Allow {
+		matched, decided := rule.match(relay, host, ips)
+		if matched {
+			return ""
+		}
+		undecided = undecided || !decided
+	}
+	if undecided {
+		// an allowed network may still contain the addresses of the host
+		return ""
+	}
+	return "not allowed"
+}
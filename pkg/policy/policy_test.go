@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"net"
+	"testing"
+)
+
+/*
+TestExcluded tests the decisions of allow and deny rules
+*/
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		relay string
+		ips   []net.IP
+		want  string
+	}{
+		{name: "Excluded_NoRules", relay: "wss://relay.example.com", want: ""},
+		{name: "Excluded_Host", deny: []string{"relay.example.com"}, relay: "wss://Relay.Example.com:443/", want: "deny relay.example.com"},
+		{name: "Excluded_OtherHost", deny: []string{"relay.example.com"}, relay: "wss://relay2.example.com", want: ""},
+		{name: "Excluded_Wildcard", deny: []string{"*.staging.example.com"}, relay: "wss://a.staging.example.com", want: "deny *.staging.example.com"},
+		{name: "Excluded_WildcardParent", deny: []string{"*.staging.example.com"}, relay: "wss://staging.example.com", want: ""},
+		{name: "Excluded_Regex", deny: []string{"regex:^ws://"}, relay: "ws://relay.example.com", want: "deny regex:^ws://"},
+		{name: "Excluded_CidrLiteral", deny: []string{"192.0.2.0/24"}, relay: "ws://192.0.2.10:7777", want: "deny 192.0.2.0/24"},
+		{name: "Excluded_CidrUnresolved", deny: []string{"192.0.2.0/24"}, relay: "wss://relay.example.com", want: ""},
+		{name: "Excluded_CidrResolved", deny: []string{"192.0.2.0/24"}, relay: "wss://relay.example.com", ips: []net.IP{net.ParseIP("192.0.2.10")}, want: "deny 192.0.2.0/24"},
+		{name: "Excluded_Allowed", allow: []string{"*.example.com"}, relay: "wss://relay.example.com", want: ""},
+		{name: "Excluded_NotAllowed", allow: []string{"*.example.com"}, relay: "wss://relay.example.org", want: "not allowed"},
+		{name: "Excluded_DenyWins", allow: []string{"*.example.com"}, deny: []string{"honeypot.example.com"}, relay: "wss://honeypot.example.com", want: "deny honeypot.example.com"},
+		{name: "Excluded_AllowCidrUnresolved", allow: []string{"198.51.100.0/24"}, relay: "wss://relay.example.org", want: ""},
+		{name: "Excluded_AllowCidrResolved", allow: []string{"198.51.100.0/24"}, relay: "wss://relay.example.org", ips: []net.IP{net.ParseIP("192.0.2.10")}, want: "not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := New(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := policy.Excluded(tt.relay, tt.ips); got != tt.want {
+				t.Errorf("Excluded() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestNew tests that invalid patterns are reported
+*/
+func TestNew(t *testing.T) {
+	if _, err := New([]string{"regex:("}, []string{"10.0.0.0/33", ""}); err == nil {
+		t.Errorf("New() expected an error")
+	}
+}
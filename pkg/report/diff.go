@@ -0,0 +1,93 @@
+package report
+
+import (
+	"fmt"
+	"io"
+)
+
+/*
+Change is a value of a relay that differs between two crawls
+*/
+type Change struct {
+	Relay string
+	From  string
+	To    string
+}
+
+/*
+CrawlDiff holds the differences between the relays of two crawls
+*/
+type CrawlDiff struct {
+	Added           []string
+	Removed         []string
+	BecameValid     []string
+	BecameInvalid   []string
+	SoftwareChanged []Change
+	VersionChanged  []Change
+}
+
+/*
+DiffCrawls compares the relays of an older and a newer crawl, both ordered by name
+*/
+func DiffCrawls(older []RelayExport, newer []RelayExport) *CrawlDiff {
+	diff := &CrawlDiff{Added: make([]string, 0), Removed: make([]string, 0), BecameValid: make([]string, 0), BecameInvalid: make([]string, 0), SoftwareChanged: make([]Change, 0), VersionChanged: make([]Change, 0)}
+	before := make(map[string]RelayExport, len(older))
+	for _, relay := range older {
+		before[relay.Name] = relay
+	}
+	seen := make(map[string]bool, len(newer))
+	for _, relay := range newer {
+		seen[relay.Name] = true
+		previous, ok := before[relay.Name]
+		if !ok {
+			diff.Added = append(diff.Added, relay.Name)
+			continue
+		}
+		if !previous.Valid && relay.Valid {
+			diff.BecameValid = append(diff.BecameValid, relay.Name)
+		}
+		if previous.Valid && !relay.Valid {
+			diff.BecameInvalid = append(diff.BecameInvalid, relay.Name)
+		}
+		if !previous.Valid || !relay.Valid {
+			// software and version are only known for valid relays
+			continue
+		}
+		if previous.Software != relay.Software {
+			diff.SoftwareChanged = append(diff.SoftwareChanged, Change{Relay: relay.Name, From: previous.Software, To: relay.Software})
+		} else if previous.Version != relay.Version {
+			diff.VersionChanged = append(diff.VersionChanged, Change{Relay: relay.Name, From: previous.Version, To: relay.Version})
+		}
+	}
+	for _, relay := range older {
+		if !seen[relay.Name] {
+			diff.Removed = append(diff.Removed, relay.Name)
+		}
+	}
+	return diff
+}
+
+/*
+PrintCrawlDiff writes the differences between two crawls
+*/
+func PrintCrawlDiff(w io.Writer, from string, to string, diff *CrawlDiff) {
+	_, _ = fmt.Fprintf(w, "Changes from crawl %v to %v:\n", from, to)
+	for _, section := range []struct {
+		title  string
+		relays []string
+	}{{"Added", diff.Added}, {"Removed", diff.Removed}, {"Became valid", diff.BecameValid}, {"Became invalid", diff.BecameInvalid}} {
+		_, _ = fmt.Fprintf(w, "%v: %v relays\n", section.title, len(section.relays))
+		for _, relay := range section.relays {
+			_, _ = fmt.Fprintf(w, "\t%v\n", relay)
+		}
+	}
+	for _, section := range []struct {
+		title   string
+		changes []Change
+	}{{"Software changed", diff.SoftwareChanged}, {"Version changed", diff.VersionChanged}} {
+		_, _ = fmt.Fprintf(w, "%v: %v relays\n", section.title, len(section.changes))
+		for _, change := range section.changes {
+			_, _ = fmt.Fprintf(w, "\t%v: %v -> %v\n", change.Relay, change.From, change.To)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+TestDiffCrawls tests the comparison of the relays of two crawls
+*/
+func TestDiffCrawls(t *testing.T) {
+	older := []RelayExport{
+		{Name: "a.example.com", Valid: true, Software: "strfry", Version: "1.0.0"},
+		{Name: "b.example.com", Valid: true, Software: "strfry", Version: "1.0.0"},
+		{Name: "c.example.com", Valid: false},
+		{Name: "d.example.com", Valid: true, Software: "nostr-rs-relay"},
+	}
+	newer := []RelayExport{
+		{Name: "a.example.com", Valid: true, Software: "strfry", Version: "1.0.1"},
+		{Name: "b.example.com", Valid: false},
+		{Name: "c.example.com", Valid: true, Software: "khatru"},
+		{Name: "e.example.com", Valid: true, Software: "khatru"},
+	}
+	want := &CrawlDiff{
+		Added:           []string{"e.example.com"},
+		Removed:         []string{"d.example.com"},
+		BecameValid:     []string{"c.example.com"},
+		BecameInvalid:   []string{"b.example.com"},
+		SoftwareChanged: []Change{},
+		VersionChanged:  []Change{{Relay: "a.example.com", From: "1.0.0", To: "1.0.1"}},
+	}
+	if got := DiffCrawls(older, newer); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffCrawls() = %+v, want %+v", got, want)
+	}
+}
+
+/*
+TestDiffCrawls_ValidityChange tests relays whose validity changed, each crawl exports only the Relay node seen in it
+although the valid and the invalid node share the name
+*/
+func TestDiffCrawls_ValidityChange(t *testing.T) {
+	valid := RelayExport{Name: "a.example.com", Valid: true, Software: "strfry", Version: "1.0.0"}
+	invalid := RelayExport{Name: "a.example.com", Valid: false, InvalidReason: "DNS resolution failed"}
+	tests := []struct {
+		name  string
+		older []RelayExport
+		newer []RelayExport
+		want  *CrawlDiff
+	}{
+		{name: "Diff_BecameInvalid", older: []RelayExport{valid}, newer: []RelayExport{invalid}, want: &CrawlDiff{
+			Added: []string{}, Removed: []string{}, BecameValid: []string{}, BecameInvalid: []string{"a.example.com"}, SoftwareChanged: []Change{}, VersionChanged: []Change{},
+		}},
+		{name: "Diff_BecameValid", older: []RelayExport{invalid}, newer: []RelayExport{valid}, want: &CrawlDiff{
+			Added: []string{}, Removed: []string{}, BecameValid: []string{"a.example.com"}, BecameInvalid: []string{}, SoftwareChanged: []Change{}, VersionChanged: []Change{},
+		}},
+		{name: "Diff_ValidAgain", older: []RelayExport{valid}, newer: []RelayExport{{Name: "a.example.com", Valid: true, Software: "strfry", Version: "1.0.0"}}, want: &CrawlDiff{
+			Added: []string{}, Removed: []string{}, BecameValid: []string{}, BecameInvalid: []string{}, SoftwareChanged: []Change{}, VersionChanged: []Change{},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffCrawls(tt.older, tt.newer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffCrawls() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
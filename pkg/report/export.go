@@ -0,0 +1,190 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
+)
+
+/*
+RelayExport holds the main results of a relay in a crawl
+*/
+type RelayExport struct {
+	Name          string   `json:"name"`
+	Valid         bool     `json:"valid"`
+	InvalidReason string   `json:"invalidReason,omitempty"`
+	Network       string   `json:"network,omitempty"`
+	Software      string   `json:"software,omitempty"`
+	Version       string   `json:"version,omitempty"`
+	AuthStatus    string   `json:"authStatus,omitempty"`
+	Nip11Class    string   `json:"nip11Class,omitempty"`
+	Category      string   `json:"category,omitempty"`
+	Nips          []int64  `json:"nips"`
+	IPs           []string `json:"ips"`
+	ErrorClass    string   `json:"errorClass,omitempty"` // class of the first failed stage
+	Error         string   `json:"error,omitempty"`
+	Stages        []Stage  `json:"stages"`
+}
+
+/*
+Stage holds how a stage of probing a relay went in a crawl
+*/
+type Stage struct {
+	Stage      string  `json:"stage"`
+	Status     string  `json:"status"`
+	ErrorClass string  `json:"errorClass,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+/*
+LatestCrawls returns the ids of the last crawls, newest first
+*/
+func LatestCrawls(neo *storage.Neo4jInstance, limit int) ([]string, error) {
+	records, err := neo.Query(`MATCH (c:Crawl) RETURN c.id AS id ORDER BY c.startedAt DESC LIMIT $limit`, map[string]any{"limit": limit})
+	if err != nil {
+		return nil, err
+	}
+	crawls := make([]string, 0, len(records))
+	for _, record := range records {
+		crawls = append(crawls, asString(record["id"]))
+	}
+	return crawls, nil
+}
+
+/*
+CrawlRelays loads the relays seen in a crawl ordered by name, software and version are the ones seen in that crawl
+*/
+func CrawlRelays(neo *storage.Neo4jInstance, crawl string) ([]RelayExport, error) {
+	records, err := neo.Query(`MATCH (c:Crawl)<-[s:SEEN_IN]-(r:Relay) WHERE c.id=$crawl
+		OPTIONAL MATCH (r)-[:IMPLEMENTS]->(n:NIP)
+		OPTIONAL MATCH (r)-[:HAS_IP]->(i:IP)
+		OPTIONAL MATCH (r)-[:PROBED]->(p:ProbeStage {crawl: $crawl})
+		RETURN r.name AS name, r.isValid AS valid, r.validReason AS invalidReason, r.network AS network, s.software AS software, s.version AS version,
+			r.authStatus AS authStatus, r.nip11Class AS nip11Class, r.category AS category, collect(DISTINCT n.name) AS nips, collect(DISTINCT i.address) AS ips,
+			collect(DISTINCT p {.stage, .position, .status, .errorClass, .error, .reason, .durationMs}) AS stages
+		ORDER BY name`, map[string]any{"crawl": crawl})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]RelayExport, 0, len(records))
+	for _, record := range records {
+		valid, _ := record["valid"].(bool)
+		relay := RelayExport{
+			Name:          asString(record["name"]),
+			Valid:         valid,
+			InvalidReason: asString(record["invalidReason"]),
+			Network:       asString(record["network"]),
+			Software:      asString(record["software"]),
+			Version:       asString(record["version"]),
+			AuthStatus:    asString(record["authStatus"]),
+			Nip11Class:    asString(record["nip11Class"]),
+			Category:      asString(record["category"]),
+			Nips:          make([]int64, 0),
+			IPs:           asStrings(record["ips"]),
+			Stages:        parseStages(record["stages"]),
+		}
+		for _, stage := range relay.Stages {
+			if stage.Status == "failed" {
+				relay.ErrorClass, relay.Error = stage.ErrorClass, stage.Error
+				break
+			}
+		}
+		if nips, ok := record["nips"].([]any); ok {
+			for _, nip := range nips {
+				relay.Nips = append(relay.Nips, asInt(nip))
+			}
+		}
+		result = append(result, relay)
+	}
+	return uniqueRelays(result), nil
+}
+
+/*
+uniqueRelays keeps one relay per name, ordered by name
+crawls before the SEEN_IN edge was scoped to a validity linked every node of the name, the node seen in the crawl is
+the one carrying the software of the crawl, or the invalid one if neither does, as valid relays always record a software
+*/
+func uniqueRelays(relays []RelayExport) []RelayExport {
+	result := make([]RelayExport, 0, len(relays))
+	for _, relay := range relays {
+		last := len(result) - 1
+		if last < 0 || result[last].Name != relay.Name {
+			result = append(result, relay)
+			continue
+		}
+		if kept := result[last]; (kept.Software == "" && relay.Software != "") || (kept.Software == "" && relay.Software == "" && kept.Valid) {
+			result[last] = relay
+		}
+	}
+	return result
+}
+
+/*
+parseStages converts the collected ProbeStage nodes to stages in the order they ran
+*/
+func parseStages(value any) []Stage {
+	values, _ := value.([]any)
+	positions := make(map[string]int64, len(values))
+	stages := make([]Stage, 0, len(values))
+	for _, v := range values {
+		node, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		durationMs, _ := node["durationMs"].(float64)
+		stage := Stage{
+			Stage: asString(node["stage"]), Status: asString(node["status"]), ErrorClass: asString(node["errorClass"]),
+			Error: asString(node["error"]), Reason: asString(node["reason"]), DurationMs: durationMs,
+		}
+		positions[stage.Stage] = asInt(node["position"])
+		stages = append(stages, stage)
+	}
+	slices.SortFunc(stages, func(a, b Stage) int { return int(positions[a.Stage] - positions[b.Stage]) })
+	return stages
+}
+
+/*
+WriteJSON writes the relays as an indented JSON array
+*/
+func WriteJSON(w io.Writer, relays []RelayExport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(relays)
+}
+
+/*
+WriteCSV writes the relays as CSV with a header, lists are separated by spaces
+the stages are written as stage=status with the error class of failed stages, e.g. nip11=failed:timeout
+*/
+func WriteCSV(w io.Writer, relays []RelayExport) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"name", "valid", "invalidReason", "network", "software", "version", "authStatus", "nip11Class", "category", "nips", "ips", "errorClass", "error", "stages"})
+	for _, relay := range relays {
+		nips := make([]string, 0, len(relay.Nips))
+		for _, nip := range relay.Nips {
+			nips = append(nips, strconv.FormatInt(nip, 10))
+		}
+		stages := make([]string, 0, len(relay.Stages))
+		for _, stage := range relay.Stages {
+			status := stage.Stage + "=" + stage.Status
+			if stage.ErrorClass != "" {
+				status += ":" + stage.ErrorClass
+			}
+			stages = append(stages, status)
+		}
+		_ = writer.Write([]string{
+			relay.Name, strconv.FormatBool(relay.Valid), relay.InvalidReason, relay.Network, relay.Software, relay.Version,
+			relay.AuthStatus, relay.Nip11Class, relay.Category, strings.Join(nips, " "), strings.Join(relay.IPs, " "),
+			relay.ErrorClass, relay.Error, strings.Join(stages, " "),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,69 @@
+package report
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+TestParseStages tests that the collected stages are ordered by the position they ran in
+*/
+func TestParseStages(t *testing.T) {
+	collected := []any{
+		map[string]any{"stage": "nip11", "position": int64(1), "status": "failed", "errorClass": "timeout", "error": "context deadline exceeded", "durationMs": 1000.5},
+		map[string]any{"stage": "validate", "position": int64(0), "status": "ok", "durationMs": 12.0},
+		map[string]any{"stage": "census", "position": int64(2), "status": "skipped", "reason": "not enabled"},
+	}
+	got := parseStages(collected)
+	if len(got) != 3 || got[0].Stage != "validate" || got[1].Stage != "nip11" || got[2].Stage != "census" {
+		t.Fatalf("parseStages() = %+v, want validate, nip11, census", got)
+	}
+	if got[1].ErrorClass != "timeout" || got[1].DurationMs != 1000.5 || got[2].Reason != "not enabled" {
+		t.Errorf("parseStages() = %+v", got)
+	}
+}
+
+/*
+TestUniqueRelays tests that a relay with a valid and an invalid node linked to the same crawl is exported once
+*/
+func TestUniqueRelays(t *testing.T) {
+	valid := RelayExport{Name: "a.example.com", Valid: true, Software: "strfry", Version: "1.0.0"}
+	stale := RelayExport{Name: "a.example.com", Valid: true}
+	invalid := RelayExport{Name: "a.example.com", Valid: false, InvalidReason: "DNS resolution failed"}
+	other := RelayExport{Name: "b.example.com", Valid: true, Software: "khatru"}
+	tests := []struct {
+		name   string
+		relays []RelayExport
+		want   []RelayExport
+	}{
+		{name: "Unique_SeenValid", relays: []RelayExport{invalid, valid, other}, want: []RelayExport{valid, other}},
+		{name: "Unique_SeenInvalid", relays: []RelayExport{stale, invalid, other}, want: []RelayExport{invalid, other}},
+		{name: "Unique_Single", relays: []RelayExport{valid, other}, want: []RelayExport{valid, other}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uniqueRelays(tt.relays); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uniqueRelays() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestWriteCSV tests the columns of the CSV export
+*/
+func TestWriteCSV(t *testing.T) {
+	relays := []RelayExport{{
+		Name: "relay.example.com", Valid: true, Nips: []int64{1, 11}, IPs: []string{"192.0.2.1"}, ErrorClass: "timeout", Error: "no EOSE",
+		Stages: []Stage{{Stage: "validate", Status: "ok"}, {Stage: "relaylist", Status: "failed", ErrorClass: "timeout"}},
+	}}
+	var out strings.Builder
+	if err := WriteCSV(&out, relays); err != nil {
+		t.Fatal(err)
+	}
+	want := "relay.example.com,true,,,,,,,,1 11,192.0.2.1,timeout,no EOSE,validate=ok relaylist=failed:timeout\n"
+	if lines := strings.SplitAfterN(out.String(), "\n", 2); len(lines) != 2 || lines[1] != want {
+		t.Errorf("WriteCSV() = %q, want second line %q", out.String(), want)
+	}
+}
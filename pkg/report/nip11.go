@@ -0,0 +1,120 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
+)
+
+/*
+RelayCompliance holds the NIP-11 classification of a single relay
+*/
+type RelayCompliance struct {
+	Relay      string
+	Software   string
+	Class      string
+	Compliant  bool
+	Violations []string
+}
+
+/*
+SoftwareCompliance holds the NIP-11 compliance of all relays running a software
+*/
+type SoftwareCompliance struct {
+	Software  string
+	Relays    int
+	Compliant int
+	Classes   map[string]int
+}
+
+/*
+Nip11Compliance loads the NIP-11 classification of every probed relay from the database
+*/
+func Nip11Compliance(neo *storage.Neo4jInstance) ([]RelayCompliance, error) {
+	records, err := neo.Query(`MATCH (r:Relay) WHERE r.nip11Class IS NOT NULL
+		OPTIONAL MATCH (r)-[:USES_SOFTWARE]->(s:Software)
+		RETURN DISTINCT r.name AS relay, coalesce(s.software, "N/A") AS software, r.nip11Class AS class, r.nip11Compliant AS compliant, r.nip11Violations AS violations
+		ORDER BY relay`, map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]RelayCompliance, 0, len(records))
+	for _, record := range records {
+		row := RelayCompliance{
+			Relay:      asString(record["relay"]),
+			Software:   asString(record["software"]),
+			Class:      asString(record["class"]),
+			Violations: asStrings(record["violations"]),
+		}
+		row.Compliant, _ = record["compliant"].(bool)
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+/*
+Nip11ComplianceBySoftware aggregates the relay compliance per software, ordered by number of relays
+*/
+func Nip11ComplianceBySoftware(relays []RelayCompliance) []SoftwareCompliance {
+	bySoftware := make(map[string]*SoftwareCompliance)
+	for _, relay := range relays {
+		entry, ok := bySoftware[relay.Software]
+		if !ok {
+			entry = &SoftwareCompliance{Software: relay.Software, Classes: make(map[string]int)}
+			bySoftware[relay.Software] = entry
+		}
+		entry.Relays++
+		entry.Classes[relay.Class]++
+		if relay.Compliant {
+			entry.Compliant++
+		}
+	}
+	result := make([]SoftwareCompliance, 0, len(bySoftware))
+	for _, entry := range bySoftware {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Relays != result[j].Relays {
+			return result[i].Relays > result[j].Relays
+		}
+		return result[i].Software < result[j].Software
+	})
+	return result
+}
+
+/*
+PrintNip11Compliance writes the compliance per software followed by the non-compliant relays
+*/
+func PrintNip11Compliance(w io.Writer, relays []RelayCompliance) {
+	_, _ = fmt.Fprintln(w, "NIP-11 compliance per software:")
+	for _, software := range Nip11ComplianceBySoftware(relays) {
+		classes := make([]string, 0, len(software.Classes))
+		for class, count := range software.Classes {
+			classes = append(classes, fmt.Sprintf("%v=%v", class, count))
+		}
+		sort.Strings(classes)
+		_, _ = fmt.Fprintf(w, "\t%v: %v/%v compliant (%v)\n", software.Software, software.Compliant, software.Relays, strings.Join(classes, ", "))
+	}
+	_, _ = fmt.Fprintln(w, "NIP-11 non-compliant relays:")
+	for _, relay := range relays {
+		if relay.Compliant {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "\t%v (%v): %v %v\n", relay.Relay, relay.Software, relay.Class, strings.Join(relay.Violations, "; "))
+	}
+}
+
+func asStrings(value any) []string {
+	values, ok := value.([]any)
+	if !ok {
+		return []string{}
+	}
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		result = append(result, asString(v))
+	}
+	return result
+}
@@ -0,0 +1,51 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
+)
+
+/*
+Operator holds a relay owner with the relays it runs
+*/
+type Operator struct {
+	PubKey string
+	Name   string
+	Relays []string
+}
+
+/*
+Operators loads the owners running at least minRelays relays, ordered by the number of relays
+*/
+func Operators(neo *storage.Neo4jInstance, minRelays int) ([]Operator, error) {
+	records, err := neo.Query(`MATCH (u:User)-[:OWNS]->(r:Relay)
+		WITH u, collect(DISTINCT r.name) AS relays
+		WHERE size(relays) >= $minRelays
+		RETURN u.pubkey AS pubkey, coalesce(u.name, "") AS name, relays
+		ORDER BY size(relays) DESC, pubkey`, map[string]any{"minRelays": minRelays})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Operator, 0, len(records))
+	for _, record := range records {
+		result = append(result, Operator{
+			PubKey: asString(record["pubkey"]),
+			Name:   asString(record["name"]),
+			Relays: asStrings(record["relays"]),
+		})
+	}
+	return result, nil
+}
+
+/*
+PrintOperators writes the operators with their relays
+*/
+func PrintOperators(w io.Writer, operators []Operator) {
+	_, _ = fmt.Fprintln(w, "Operators running multiple relays:")
+	for _, operator := range operators {
+		_, _ = fmt.Fprintf(w, "\t%v %v: %v relays (%v)\n", operator.PubKey, operator.Name, len(operator.Relays), strings.Join(operator.Relays, ", "))
+	}
+}
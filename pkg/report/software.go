@@ -0,0 +1,114 @@
+package report
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
+)
+
+/*
+SoftwareVersionCount holds the number of relays running a version of a software
+*/
+type SoftwareVersionCount struct {
+	Software string
+	Version  string
+	Relays   int64
+	Outdated bool // a newer semantic version of the same software was seen
+}
+
+/*
+SoftwareVersions loads the version distribution per software seen in a crawl from the database
+the software edges of a relay accumulate over crawls, so the software and version recorded on SEEN_IN are counted
+relays with a software but without a version are counted as version "unknown"
+*/
+func SoftwareVersions(neo *storage.Neo4jInstance, crawl string) ([]SoftwareVersionCount, error) {
+	records, err := neo.Query(`MATCH (c:Crawl)<-[s:SEEN_IN]-(r:Relay) WHERE c.id=$crawl and s.software IS NOT NULL
+		RETURN s.software AS software, CASE WHEN coalesce(s.version, "") = "" THEN "unknown" ELSE s.version END AS version, count(DISTINCT r.name) AS relays
+		ORDER BY software, relays DESC, version`, map[string]any{"crawl": crawl})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SoftwareVersionCount, 0, len(records))
+	latest := make(map[string]helper.Semver)
+	for _, record := range records {
+		row := SoftwareVersionCount{
+			Software: asString(record["software"]),
+			Version:  asString(record["version"]),
+			Relays:   asInt(record["relays"]),
+		}
+		if semver, ok := helper.ParseSemver(row.Version); ok && compareSemver(semver, latest[row.Software]) > 0 {
+			latest[row.Software] = semver
+		}
+		result = append(result, row)
+	}
+	for i, row := range result {
+		if semver, ok := helper.ParseSemver(row.Version); ok {
+			result[i].Outdated = compareSemver(semver, latest[row.Software]) < 0
+		}
+	}
+	return result, nil
+}
+
+/*
+PrintSoftwareVersions writes the version distribution grouped by software
+*/
+func PrintSoftwareVersions(w io.Writer, rows []SoftwareVersionCount) {
+	totals := make(map[string]int64)
+	for _, row := range rows {
+		totals[row.Software] += row.Relays
+	}
+	current := ""
+	for _, row := range rows {
+		if row.Software != current {
+			current = row.Software
+			_, _ = fmt.Fprintf(w, "Software: %v (%v relays)\n", row.Software, totals[row.Software])
+		}
+		outdated := ""
+		if row.Outdated {
+			outdated = " (outdated)"
+		}
+		_, _ = fmt.Fprintf(w, "\t%v: %v relays, %.1f%%%v\n", row.Version, row.Relays, 100*float64(row.Relays)/float64(totals[row.Software]), outdated)
+	}
+}
+
+/*
+compareSemver compares two versions and returns -1, 0 or 1, pre-releases are ordered before their release
+*/
+func compareSemver(a helper.Semver, b helper.Semver) int {
+	for _, diff := range []int{a.Major - b.Major, a.Minor - b.Minor, a.Patch - b.Patch} {
+		if diff < 0 {
+			return -1
+		} else if diff > 0 {
+			return 1
+		}
+	}
+	if a.Prerelease == b.Prerelease {
+		return 0
+	} else if a.Prerelease == "" {
+		return 1
+	} else if b.Prerelease == "" {
+		return -1
+	} else if a.Prerelease < b.Prerelease {
+		return -1
+	}
+	return 1
+}
+
+func asString(value any) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func asInt(value any) int64 {
+	if i, ok := value.(int64); ok {
+		return i
+	}
+	return 0
+}
@@ -0,0 +1,270 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+/*
+Classes of resolution errors
+*/
+const (
+	ErrorNxDomain  = "nxdomain"
+	ErrorServFail  = "servfail"
+	ErrorRefused   = "refused"
+	ErrorTimeout   = "timeout"
+	ErrorNoAddress = "no_address" // the name exists but has neither A nor AAAA records
+	ErrorOther     = "error"
+)
+
+/*
+defaultServer is used if no upstream is configured and /etc/resolv.conf cannot be read
+*/
+const defaultServer = "1.1.1.1:53"
+
+/*
+Record is a single answer with its time to live in seconds
+*/
+type Record struct {
+	Value string
+	TTL   uint32
+}
+
+/*
+Resolution holds the DNS records of a hostname
+*/
+type Resolution struct {
+	Host   string
+	Server string
+	A      []Record
+	AAAA   []Record
+	CNAMEs []Record // the chain of aliases in the order they are followed
+	NS     []Record // the name servers of the closest enclosing zone
+	Error  string   // class of the resolution error, empty on success
+	Detail string   // the underlying error message
+}
+
+/*
+IPs returns the IPv4 and IPv6 addresses of the resolution
+*/
+func (r *Resolution) IPs() []net.IP {
+	ips := make([]net.IP, 0, len(r.A)+len(r.AAAA))
+	for _, record := range append(append([]Record{}, r.A...), r.AAAA...) {
+		if ip := net.ParseIP(record.Value); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+/*
+Resolver queries an upstream DNS server directly to keep the record types and TTLs
+*/
+type Resolver struct {
+	Server  string // host:port of the upstream, empty uses the first server of /etc/resolv.conf
+	Timeout time.Duration
+}
+
+/*
+Resolve looks up the A, AAAA, CNAME and NS records of the hostname
+*/
+func (r *Resolver) Resolve(host string) *Resolution {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	resolution := &Resolution{Host: host, Server: r.server(), A: make([]Record, 0), AAAA: make([]Record, 0), CNAMEs: make([]Record, 0), NS: make([]Record, 0)}
+	if ip := net.ParseIP(host); ip != nil {
+		// literal addresses need no lookup
+		if ip.To4() != nil {
+			resolution.A = append(resolution.A, Record{Value: ip.String()})
+		} else {
+			resolution.AAAA = append(resolution.AAAA, Record{Value: ip.String()})
+		}
+		return resolution
+	}
+
+	answer, err := r.exchange(host, dns.TypeA)
+	if class := ErrorClass(answer, err); class != "" {
+		resolution.Error, resolution.Detail = class, errorDetail(answer, err)
+		return resolution
+	}
+	resolution.CNAMEs = CNAMEChain(answer)
+	resolution.A = Addresses(answer)
+	if answer, err = r.exchange(host, dns.TypeAAAA); ErrorClass(answer, err) == "" {
+		resolution.AAAA = Addresses(answer)
+	}
+	resolution.NS = r.nameServers(host)
+	if len(resolution.A) == 0 && len(resolution.AAAA) == 0 {
+		resolution.Error = ErrorNoAddress
+	}
+	return resolution
+}
+
+/*
+nameServers returns the NS records of the closest zone enclosing the hostname
+*/
+func (r *Resolver) nameServers(host string) []Record {
+	for name := host; strings.Contains(name, "."); name = name[strings.Index(name, ".")+1:] {
+		answer, err := r.exchange(name, dns.TypeNS)
+		if ErrorClass(answer, err) != "" {
+			continue
+		}
+		records := make([]Record, 0)
+		for _, rr := range answer.Answer {
+			if ns, ok := rr.(*dns.NS); ok {
+				records = append(records, Record{Value: strings.TrimSuffix(ns.Ns, "."), TTL: ns.Hdr.Ttl})
+			}
+		}
+		if len(records) > 0 {
+			return records
+		}
+	}
+	return make([]Record, 0)
+}
+
+/*
+exchange sends a recursive query to the upstream, truncated answers are repeated over TCP
+*/
+func (r *Resolver) exchange(name string, qtype uint16) (*dns.Msg, error) {
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(name), qtype)
+	query.RecursionDesired = true
+	client := &dns.Client{Timeout: r.timeout()}
+	answer, _, err := client.Exchange(query, r.server())
+	if err == nil && answer.Truncated {
+		client.Net = "tcp"
+		answer, _, err = client.Exchange(query, r.server())
+	}
+	return answer, err
+}
+
+func (r *Resolver) server() string {
+	if r.Server != "" {
+		return WithPort(r.Server)
+	}
+	return systemServer()
+}
+
+/*
+systemServer returns the first server of /etc/resolv.conf, the file is only read once
+*/
+var systemServer = sync.OnceValue(func() string {
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil || len(config.Servers) == 0 {
+		return defaultServer
+	}
+	return net.JoinHostPort(config.Servers[0], config.Port)
+})
+
+func (r *Resolver) timeout() time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	return 3 * time.Second
+}
+
+/*
+WithPort adds the default DNS port to a server address without one
+*/
+func WithPort(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "53")
+}
+
+/*
+ErrorClass classifies the outcome of a query, an empty class means the query succeeded
+*/
+func ErrorClass(answer *dns.Msg, err error) string {
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorOther
+	}
+	switch answer.Rcode {
+	case dns.RcodeSuccess:
+		return ""
+	case dns.RcodeNameError:
+		return ErrorNxDomain
+	case dns.RcodeServerFailure:
+		return ErrorServFail
+	case dns.RcodeRefused:
+		return ErrorRefused
+	default:
+		return ErrorOther
+	}
+}
+
+func errorDetail(answer *dns.Msg, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return dns.RcodeToString[answer.Rcode]
+}
+
+/*
+CNAMEChain returns the aliases of an answer in the order they are followed from the queried name
+*/
+func CNAMEChain(answer *dns.Msg) []Record {
+	aliases := make(map[string]*dns.CNAME)
+	for _, rr := range answer.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			aliases[strings.ToLower(cname.Hdr.Name)] = cname
+		}
+	}
+	chain := make([]Record, 0)
+	name := strings.ToLower(answer.Question[0].Name)
+	// the length bound protects against alias loops
+	for len(chain) < len(aliases) {
+		cname, ok := aliases[name]
+		if !ok {
+			break
+		}
+		chain = append(chain, Record{Value: strings.TrimSuffix(cname.Target, "."), TTL: cname.Hdr.Ttl})
+		name = strings.ToLower(cname.Target)
+	}
+	return chain
+}
+
+/*
+Addresses returns the A and AAAA records of an answer
+*/
+func Addresses(answer *dns.Msg) []Record {
+	records := make([]Record, 0)
+	for _, rr := range answer.Answer {
+		switch record := rr.(type) {
+		case *dns.A:
+			records = append(records, Record{Value: record.A.String(), TTL: record.Hdr.Ttl})
+		case *dns.AAAA:
+			records = append(records, Record{Value: record.AAAA.String(), TTL: record.Hdr.Ttl})
+		}
+	}
+	return records
+}
+
+/*
+Reverse looks up the PTR records of an IP address, the error class is empty on success
+*/
+func (r *Resolver) Reverse(ip net.IP) ([]Record, string) {
+	records := make([]Record, 0)
+	name, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return records, ErrorOther
+	}
+	answer, err := r.exchange(name, dns.TypePTR)
+	if class := ErrorClass(answer, err); class != "" {
+		return records, class
+	}
+	for _, rr := range answer.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			records = append(records, Record{Value: strings.TrimSuffix(strings.ToLower(ptr.Ptr), "."), TTL: ptr.Hdr.Ttl})
+		}
+	}
+	return records, ""
+}
@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+/*
+TestCNAMEChain tests that the aliases are returned in the order they are followed
+*/
+func TestCNAMEChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		want    []Record
+	}{
+		{name: "Chain_None", records: []string{"relay.example.com. 300 IN A 192.0.2.1"}, want: []Record{}},
+		{name: "Chain_Ordered", records: []string{
+			"edge.cdn.net. 60 IN CNAME edge.cdn-provider.net.",
+			"relay.example.com. 300 IN CNAME edge.cdn.net.",
+			"edge.cdn-provider.net. 20 IN A 192.0.2.1",
+		}, want: []Record{{Value: "edge.cdn.net", TTL: 300}, {Value: "edge.cdn-provider.net", TTL: 60}}},
+		{name: "Chain_Loop", records: []string{
+			"relay.example.com. 300 IN CNAME other.example.com.",
+			"other.example.com. 300 IN CNAME relay.example.com.",
+		}, want: []Record{{Value: "other.example.com", TTL: 300}, {Value: "relay.example.com", TTL: 300}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer := new(dns.Msg)
+			answer.SetQuestion("relay.example.com.", dns.TypeA)
+			for _, record := range tt.records {
+				rr, err := dns.NewRR(record)
+				if err != nil {
+					t.Fatal(err)
+				}
+				answer.Answer = append(answer.Answer, rr)
+			}
+			if got := CNAMEChain(answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CNAMEChain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+timeoutError mimics the timeout of a network read
+*/
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+/*
+TestErrorClass tests the classification of failed queries
+*/
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name  string
+		rcode int
+		err   error
+		want  string
+	}{
+		{name: "Class_Success", rcode: dns.RcodeSuccess, want: ""},
+		{name: "Class_NxDomain", rcode: dns.RcodeNameError, want: ErrorNxDomain},
+		{name: "Class_ServFail", rcode: dns.RcodeServerFailure, want: ErrorServFail},
+		{name: "Class_Refused", rcode: dns.RcodeRefused, want: ErrorRefused},
+		{name: "Class_Timeout", err: timeoutError{}, want: ErrorTimeout},
+		{name: "Class_Other", err: errors.New("connection refused"), want: ErrorOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer := &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: tt.rcode}}
+			if got := ErrorClass(answer, tt.err); got != tt.want {
+				t.Errorf("ErrorClass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestWithPort tests that the default port is added to server addresses
+*/
+func TestWithPort(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{server: "9.9.9.9", want: "9.9.9.9:53"},
+		{server: "9.9.9.9:5353", want: "9.9.9.9:5353"},
+		{server: "2620:fe::fe", want: "[2620:fe::fe]:53"},
+		{server: "[2620:fe::fe]:53", want: "[2620:fe::fe]:53"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server, func(t *testing.T) {
+			if got := WithPort(tt.server); got != tt.want {
+				t.Errorf("WithPort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package seeds
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/helper"
+	"github.com/SEG-UNIBE/artio-miner/pkg/miner"
+	"github.com/SEG-UNIBE/artio-miner/pkg/storage"
+	"golang.org/x/net/publicsuffix"
+)
+
+/*
+Loader collects the seed relays of a crawl from the configured sources
+a source is one of
+  - a relay URL (wss://relay.example.com)
+  - file:<path> a text file with one relay per line or a CSV file with a relay column
+  - stdin (or -) the same format read from the standard input
+  - db:valid or db:all the relays valid in or seen by the last crawl in the database
+  - url:<http url> a JSON array of relay URLs or a text list as published by relay directories
+  - nip66:<relay> the relays reported in NIP-66 discovery events on the relay
+*/
+type Loader struct {
+	Neo        *storage.Neo4jInstance // needed for the db sources
+	Stdin      io.Reader
+	Nip66Limit int
+}
+
+/*
+Load reads all sources and returns the normalised relays without duplicates, failing sources are reported together
+*/
+func (l *Loader) Load(sources []string) ([]string, error) {
+	relays := make([]string, 0)
+	var errs []error
+	for _, source := range sources {
+		found, err := l.load(strings.TrimSpace(source))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("seed source %s: %w", source, err))
+			continue
+		}
+		relays = append(relays, found...)
+	}
+	return Dedup(relays), errors.Join(errs...)
+}
+
+func (l *Loader) load(source string) ([]string, error) {
+	kind, value, _ := strings.Cut(source, ":")
+	switch {
+	case source == "stdin" || source == "-":
+		if l.Stdin == nil {
+			return nil, errors.New("no standard input")
+		}
+		return Parse(l.Stdin), nil
+	case kind == "file":
+		file, err := os.Open(value)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return Parse(file), nil
+	case kind == "db":
+		return l.fromDatabase(value)
+	case kind == "url":
+		return fromURL(value)
+	case kind == "nip66":
+		reports, _, err := miner.DiscoverRelays([]string{value}, l.Nip66Limit)
+		if err != nil {
+			return nil, err
+		}
+		relays := make([]string, 0, len(reports))
+		for _, report := range reports {
+			relays = append(relays, report.Relay)
+		}
+		return relays, nil
+	case kind == "ws" || kind == "wss":
+		return []string{source}, nil
+	default:
+		return nil, errors.New("unknown source, use a relay URL, file:, stdin, db:, url: or nip66:")
+	}
+}
+
+/*
+fromDatabase loads the relays of the last crawl, all of them or only the valid ones
+*/
+func (l *Loader) fromDatabase(selection string) ([]string, error) {
+	if selection != "valid" && selection != "all" {
+		return nil, errors.New("use db:valid or db:all")
+	}
+	if l.Neo == nil {
+		return nil, errors.New("no database configured")
+	}
+	records, err := l.Neo.Query(`MATCH (c:Crawl) WITH c ORDER BY c.startedAt DESC LIMIT 1
+		MATCH (c)<-[:SEEN_IN]-(r:Relay)-[:ALT_NAME]->(a:RelayAlternativeName)
+		WHERE $all OR r.isValid=true
+		RETURN DISTINCT a.name AS relay`, map[string]any{"all": selection == "all"})
+	if err != nil {
+		return nil, err
+	}
+	relays := make([]string, 0, len(records))
+	for _, record := range records {
+		if relay, ok := record["relay"].(string); ok {
+			relays = append(relays, relay)
+		}
+	}
+	return relays, nil
+}
+
+/*
+fromURL downloads a relay list, JSON arrays of strings are decoded and anything else is parsed as text
+*/
+func fromURL(address string) ([]string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(address)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	var relays []string
+	if json.Unmarshal(body, &relays) == nil {
+		return relays, nil
+	}
+	return Parse(strings.NewReader(string(body))), nil
+}
+
+/*
+Parse reads relays from a text or CSV document, every field that looks like a relay address is taken
+empty lines, comments starting with # and header fields are skipped
+*/
+func Parse(r io.Reader) []string {
+	relays := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ';' || c == ' ' || c == '\t' || c == '"'
+		})
+		for _, field := range fields {
+			if isRelayField(field) {
+				relays = append(relays, field)
+			}
+		}
+	}
+	return relays
+}
+
+/*
+documentExtensions are file extensions of free text that are also top level domains
+*/
+var documentExtensions = []string{".md", ".sh", ".py"}
+
+/*
+isRelayField accepts websocket URLs and bare hostnames under a known public suffix
+words like "e.g.", versions like "v1.2.3" and file names like "README.md" are no relays
+*/
+func isRelayField(field string) bool {
+	lower := strings.ToLower(field)
+	if strings.HasPrefix(lower, "ws://") || strings.HasPrefix(lower, "wss://") {
+		return true
+	}
+	host, _, _ := strings.Cut(strings.TrimSuffix(lower, "/"), ":")
+	if strings.Contains(host, "/") || strings.HasSuffix(host, ".") || !strings.Contains(host, ".") {
+		return false
+	}
+	for _, extension := range documentExtensions {
+		if strings.HasSuffix(host, extension) {
+			return false
+		}
+	}
+	if valid, _ := helper.ValidateURL("wss://" + host); !valid {
+		return false
+	}
+	// unknown top level domains fall back to their last label, private suffixes like github.io have several
+	suffix, icann := publicsuffix.PublicSuffix(host)
+	return suffix != host && (icann || strings.Contains(suffix, "."))
+}
+
+/*
+Dedup normalises the relays and drops invalid and duplicate ones, the first occurrence keeps its position
+*/
+func Dedup(relays []string) []string {
+	result := make([]string, 0, len(relays))
+	seen := make(map[string]bool, len(relays))
+	for _, relay := range relays {
+		normalized, ok := helper.NormalizeRelayURL(relay)
+		if !ok || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+		result = append(result, normalized)
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package seeds
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/*
+TestParse tests reading relays from text and CSV documents
+*/
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []string
+	}{
+		{name: "Parse_Text", document: "# seeds\nwss://relay.damus.io\n\nnos.lol\n", want: []string{"wss://relay.damus.io", "nos.lol"}},
+		{name: "Parse_Csv", document: "url,users,uptime\n\"wss://relay.damus.io\",120,0.99\nwss://nos.lol/,80,1\n", want: []string{"wss://relay.damus.io", "wss://nos.lol/"}},
+		{name: "Parse_FreeText", document: "Relays run by Example Inc. e.g. relay.example.com:7777 or wss://nos.lol\n", want: []string{"relay.example.com:7777", "wss://nos.lol"}},
+		{name: "Parse_NoRelays", document: "see README.md and install.sh, v1.2.3 of strfry\nfile,notes.txt,10.0.0.1,192.168.1.1,localhost,https://example.com\n", want: []string{}},
+		{name: "Parse_PrivateSuffix", document: "relay.github.io\nrelay.unknowntld\n", want: []string{"relay.github.io"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(strings.NewReader(tt.document)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+TestLoad tests that the sources are combined and deduplicated through the relay normaliser
+*/
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds.txt")
+	if err := os.WriteFile(path, []byte("wss://relay.damus.io/\nrelay.nostr.band\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loader := Loader{Stdin: strings.NewReader("wss://RELAY.DAMUS.IO:443\nwss://nos.lol\n")}
+	got, err := loader.Load([]string{"wss://nos.lol/", "file:" + path, "stdin"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []string{"wss://nos.lol", "wss://relay.damus.io", "wss://relay.nostr.band"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, want %v", got, want)
+	}
+
+	if _, err := loader.Load([]string{"file:" + path + ".missing", "db:valid", "gopher:x"}); err == nil || strings.Count(err.Error(), "seed source") != 3 {
+		t.Errorf("Load() error = %v, want three failing sources", err)
+	}
+}
@@ -0,0 +1,60 @@
+package status
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/miner"
+)
+
+/*
+dashboard is the page visualising the progress of a crawl from the JSON endpoints
+*/
+//go:embed dashboard.html
+var dashboard []byte
+
+/*
+Source provides the progress and results of a crawl, implemented by miner.Manager
+*/
+type Source interface {
+	Status() miner.CrawlStatus
+	Results() []miner.RelayResult
+	Result(name string) (miner.RelayResult, bool)
+}
+
+/*
+Handler returns the status API and the dashboard
+  - GET /api/status the progress of the crawl
+  - GET /api/relays the results of all relays mined so far
+  - GET /api/relays/{name} the result of a single relay by its cleaned name
+  - GET / the dashboard
+*/
+func Handler(source Source) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, source.Status())
+	})
+	mux.HandleFunc("GET /api/relays", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, source.Results())
+	})
+	mux.HandleFunc("GET /api/relays/{name}", func(w http.ResponseWriter, r *http.Request) {
+		result, ok := source.Result(r.PathValue("name"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "relay not mined in this crawl"})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(dashboard)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
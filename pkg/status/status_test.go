@@ -0,0 +1,68 @@
+package status
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SEG-UNIBE/artio-miner/pkg/miner"
+)
+
+/*
+fakeSource serves a fixed crawl
+*/
+type fakeSource struct{}
+
+func (fakeSource) Status() miner.CrawlStatus {
+	return miner.CrawlStatus{CrawlId: "20260101T000000Z", Running: true, Visited: 2, Frontier: 3}
+}
+
+func (fakeSource) Results() []miner.RelayResult {
+	return []miner.RelayResult{{Relay: "relay.example.com", Valid: true}}
+}
+
+func (fakeSource) Result(name string) (miner.RelayResult, bool) {
+	if name != "relay.example.com" {
+		return miner.RelayResult{}, false
+	}
+	return miner.RelayResult{Relay: name, Valid: true}, true
+}
+
+/*
+TestHandler tests the endpoints of the status API
+*/
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(Handler(fakeSource{}))
+	defer server.Close()
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Status", path: "/api/status", wantStatus: http.StatusOK, wantBody: `"frontier":3`},
+		{name: "Relays", path: "/api/relays", wantStatus: http.StatusOK, wantBody: `"relay":"relay.example.com"`},
+		{name: "Relay", path: "/api/relays/relay.example.com", wantStatus: http.StatusOK, wantBody: `"valid":true`},
+		{name: "RelayMissing", path: "/api/relays/other.example.com", wantStatus: http.StatusNotFound, wantBody: `"error"`},
+		{name: "Dashboard", path: "/", wantStatus: http.StatusOK, wantBody: "<title>artio-miner</title>"},
+		{name: "Unknown", path: "/unknown", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("GET %s = %d %s, want %d containing %s", tt.path, resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package storage
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/SEG-UNIBE/artio-miner/pkg/metrics"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
 
@@ -69,12 +71,69 @@ func (neo *Neo4jInstance) SetDebug(debug bool) {
 Execute the given query with the params
 */
 func (neo *Neo4jInstance) Execute(query string, params map[string]any) {
+	start := time.Now()
 	result, err := neo4j.ExecuteQuery(neo.ctx, neo.driver, query, params, neo4j.EagerResultTransformer, neo.configOptions)
 	if err != nil {
 		panic(err)
 	}
 	summary := result.Summary
+	counters := summary.Counters()
+	metrics.StorageWriteSeconds.Observe(time.Since(start).Seconds())
+	metrics.StorageBatchSize.Observe(float64(counters.NodesCreated() + counters.RelationshipsCreated() + counters.PropertiesSet()))
 	if neo.debug {
 		fmt.Printf("Created %v nodes in %+v.\n", summary.Counters().NodesCreated(), summary.ResultAvailableAfter())
 	}
 }
+
+/*
+Query runs the given read query with the params and returns the records as maps
+*/
+func (neo *Neo4jInstance) Query(query string, params map[string]any) ([]map[string]any, error) {
+	result, err := neo4j.ExecuteQuery(neo.ctx, neo.driver, query, params, neo4j.EagerResultTransformer, neo.configOptions)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]map[string]any, 0, len(result.Records))
+	for _, record := range result.Records {
+		records = append(records, record.AsMap())
+	}
+	return records, nil
+}
+
+/*
+Schema holds the constraints and indexes of the graph written by the miner
+relays are only indexed, their nodes are merged together with the validity and may exist once per validity
+*/
+var Schema = []string{
+	`CREATE CONSTRAINT crawl_id IF NOT EXISTS FOR (c:Crawl) REQUIRE c.id IS UNIQUE`,
+	`CREATE CONSTRAINT nip_name IF NOT EXISTS FOR (n:NIP) REQUIRE n.name IS UNIQUE`,
+	`CREATE CONSTRAINT user_pubkey IF NOT EXISTS FOR (u:User) REQUIRE u.pubkey IS UNIQUE`,
+	`CREATE CONSTRAINT ip_address IF NOT EXISTS FOR (i:IP) REQUIRE i.address IS UNIQUE`,
+	`CREATE CONSTRAINT software_name IF NOT EXISTS FOR (s:Software) REQUIRE s.software IS UNIQUE`,
+	`CREATE CONSTRAINT country_code IF NOT EXISTS FOR (c:Country) REQUIRE c.code IS UNIQUE`,
+	`CREATE CONSTRAINT asn_number IF NOT EXISTS FOR (a:ASN) REQUIRE a.number IS UNIQUE`,
+	`CREATE CONSTRAINT cname_name IF NOT EXISTS FOR (c:CNAME) REQUIRE c.name IS UNIQUE`,
+	`CREATE CONSTRAINT nameserver_name IF NOT EXISTS FOR (n:NameServer) REQUIRE n.name IS UNIQUE`,
+	`CREATE CONSTRAINT kind_number IF NOT EXISTS FOR (k:Kind) REQUIRE k.number IS UNIQUE`,
+	`CREATE CONSTRAINT monitor_pubkey IF NOT EXISTS FOR (m:Monitor) REQUIRE m.pubkey IS UNIQUE`,
+	`CREATE CONSTRAINT domain_name IF NOT EXISTS FOR (d:Domain) REQUIRE d.name IS UNIQUE`,
+	`CREATE INDEX relay_name IF NOT EXISTS FOR (r:Relay) ON (r.name)`,
+	`CREATE INDEX relay_alternative_name IF NOT EXISTS FOR (r:RelayAlternativeName) ON (r.name)`,
+	`CREATE INDEX software_version IF NOT EXISTS FOR (v:SoftwareVersion) ON (v.software, v.version)`,
+	`CREATE INDEX timing_relay IF NOT EXISTS FOR (t:Timing) ON (t.relay, t.crawl, t.stage)`,
+	`CREATE INDEX probe_stage_relay IF NOT EXISTS FOR (p:ProbeStage) ON (p.relay, p.crawl, p.stage)`,
+	`CREATE INDEX check_relay IF NOT EXISTS FOR (c:Check) ON (c.relay, c.time)`,
+	`CREATE INDEX hosting_cluster IF NOT EXISTS FOR (h:HostingCluster) ON (h.kind, h.key)`,
+}
+
+/*
+ApplySchema creates the constraints and indexes of the Schema that do not exist yet
+*/
+func (neo *Neo4jInstance) ApplySchema() error {
+	for _, statement := range Schema {
+		if _, err := neo.Query(statement, map[string]any{}); err != nil {
+			return fmt.Errorf("%s: %w", statement, err)
+		}
+	}
+	return nil
+}